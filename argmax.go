@@ -0,0 +1,46 @@
+package pipe
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// ArgListTooLongError is returned, wrapped, when a stage's arguments and environment are larger than the operating
+// system will accept.  It is checked before the stage starts, so the error can say which stage is too big instead of
+// the bare E2BIG the operating system gives, which errors.Is still matches.
+type ArgListTooLongError struct {
+	// Stage is the index of the stage, starting at zero for the head of the pipeline
+	Stage int
+	Cmd   string
+	// Size is the approximate number of bytes the stage needed and Limit is what the platform allows
+	Size  int
+	Limit int
+}
+
+func (e *ArgListTooLongError) Error() string {
+	return fmt.Sprintf("argument list too long for stage %d %q (%d bytes, limit %d)", e.Stage, e.Cmd, e.Size, e.Limit)
+}
+
+func (e *ArgListTooLongError) Unwrap() error {
+	return syscall.E2BIG
+}
+
+// checkArgList returns an *ArgListTooLongError if cmd is too big to exec.
+func checkArgList(stage int, cmd *exec.Cmd) error {
+	env := cmd.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	size, limit, ok := argListSize(cmd.Args, env)
+	if ok {
+		return nil
+	}
+	return &ArgListTooLongError{
+		Stage: stage,
+		Cmd:   cmd.Path,
+		Size:  size,
+		Limit: limit,
+	}
+}
@@ -0,0 +1,11 @@
+package pipe
+
+// argMax is ARG_MAX, which on macOS covers both the arguments and the environment
+const argMax = 1024 * 1024
+
+// argListSize returns the bytes argv and env take when exec'd, counting their terminators and pointers, and the limit
+// they must fit in.
+func argListSize(argv []string, env []string) (int, int, bool) {
+	size, _ := execSize(argv, env)
+	return size, argMax, size <= argMax
+}
@@ -0,0 +1,30 @@
+package pipe
+
+import "syscall"
+
+const (
+	// minArgMax is the ARG_MAX Linux guarantees however small the stack limit is
+	minArgMax = 128 * 1024
+	// maxArgMax is the most Linux allows, three quarters of the default 8MB stack, however large the stack limit is
+	maxArgMax = 6 * 1024 * 1024
+	// maxArgStrlen is MAX_ARG_STRLEN, the most Linux accepts for any one argument or environment string
+	maxArgStrlen = 128 * 1024
+)
+
+// argListSize returns the bytes argv and env take when exec'd, counting their terminators and pointers, and the limit
+// they must fit in.  Linux allows a quarter of the stack limit, so the limit is read from the current rlimit.
+func argListSize(argv []string, env []string) (int, int, bool) {
+	limit := maxArgMax
+	var rlim syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_STACK, &rlim); err == nil && rlim.Cur/4 < uint64(limit) {
+		limit = int(rlim.Cur / 4)
+	}
+	if limit < minArgMax {
+		limit = minArgMax
+	}
+	size, longest := execSize(argv, env)
+	if longest+1 > maxArgStrlen {
+		return longest + 1, maxArgStrlen, false
+	}
+	return size, limit, size <= limit
+}
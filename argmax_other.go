@@ -0,0 +1,13 @@
+//go:build !linux && !darwin && !windows
+
+package pipe
+
+// argMax is the smallest ARG_MAX of the BSDs, used for every platform without a more precise limit
+const argMax = 256 * 1024
+
+// argListSize returns the bytes argv and env take when exec'd, counting their terminators and pointers, and the limit
+// they must fit in.
+func argListSize(argv []string, env []string) (int, int, bool) {
+	size, _ := execSize(argv, env)
+	return size, argMax, size <= argMax
+}
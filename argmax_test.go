@@ -0,0 +1,26 @@
+package pipe_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/cresta/pipe"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArgListTooLong(t *testing.T) {
+	args := make([]string, 0, 100000)
+	for i := 0; i < cap(args); i++ {
+		args = append(args, strings.Repeat("x", 100))
+	}
+	err := pipe.Shell("echo hi").Pipe("echo", args...).Run(context.Background())
+	var tooLong *pipe.ArgListTooLongError
+	require.True(t, errors.As(err, &tooLong))
+	require.Equal(t, 1, tooLong.Stage)
+	require.Greater(t, tooLong.Size, tooLong.Limit)
+	require.ErrorIs(t, err, syscall.E2BIG)
+	require.Contains(t, err.Error(), "argument list too long for stage 1")
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+
+package pipe
+
+import "unsafe"
+
+// execSize returns the bytes argv and env take when exec'd, counting their terminators and pointers, and the length of
+// the longest string in either.
+func execSize(argv []string, env []string) (size int, longest int) {
+	for _, strs := range [][]string{argv, env} {
+		for _, s := range strs {
+			if len(s) > longest {
+				longest = len(s)
+			}
+			size += len(s) + 1 + int(unsafe.Sizeof(uintptr(0)))
+		}
+	}
+	return size, longest
+}
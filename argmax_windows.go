@@ -0,0 +1,17 @@
+package pipe
+
+import "unicode/utf16"
+
+// maxCommandLine is the most UTF-16 characters CreateProcess accepts for the command line.  The environment has its
+// own, much larger, limit and is not counted.
+const maxCommandLine = 32767
+
+// argListSize returns the length of the command line argv becomes, approximating the quoting os/exec adds by counting
+// two quotes and a space per argument, and the limit it must fit in.
+func argListSize(argv []string, _ []string) (int, int, bool) {
+	size := 0
+	for _, s := range argv {
+		size += len(utf16.Encode([]rune(s))) + 3
+	}
+	return size, maxCommandLine, size <= maxCommandLine
+}
@@ -0,0 +1,203 @@
+package pipe
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// maxBraceArgs is the most arguments brace expansion may give one stage, so a range like {1..999999999} fails rather
+// than exhausting memory.
+const maxBraceArgs = 100000
+
+// ErrBraceExpansionTooLarge is returned when brace expansion would give a stage more than maxBraceArgs arguments.
+var ErrBraceExpansionTooLarge = errors.New("brace expansion gives too many arguments")
+
+// WithBraceExpansion expands braces in the arguments of every stage into several arguments, the way bash does, when
+// the pipeline runs.  A comma list gives one argument for each of its items and a range gives one for each of its
+// values, counting by the optional step:
+//
+//	file.{txt,md}   file.txt file.md
+//	img{1..3}.png   img1.png img2.png img3.png
+//	{a..e..2}       a c e
+//	{01..10}        01 02 ... 10
+//	x{a,b{1,2}}     xa xb1 xb2
+//
+// Braces that are not matched, or hold neither a comma nor a valid range, like {} or {tempdir}, are left as they are.
+// Arguments are expanded whether or not they were quoted on a Shell line, since the quotes are gone by then.  The
+// pipeline fails with ErrBraceExpansionTooLarge if a stage's arguments would expand to more than 100000.
+func (p *PipedCmd) WithBraceExpansion() *PipedCmd {
+	return p.setOption(func(o *options) {
+		o.braceExpansion = true
+	})
+}
+
+func expandBraceArgs(args []string) ([]string, error) {
+	ret := make([]string, 0, len(args))
+	for _, a := range args {
+		expanded, err := expandBraces(a, maxBraceArgs-len(ret))
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, expanded...)
+	}
+	return ret, nil
+}
+
+// expandBraces expands the first brace expression in word and then, recursively, any others in what that gives.  It
+// fails with ErrBraceExpansionTooLarge rather than give more than max words.
+func expandBraces(word string, max int) ([]string, error) {
+	for start := 0; start < len(word); start++ {
+		if word[start] != '{' {
+			continue
+		}
+		end := -1
+		depth := 0
+		var commas []int
+	scan:
+		for i := start; i < len(word); i++ {
+			switch word[i] {
+			case '{':
+				depth++
+			case '}':
+				depth--
+				if depth == 0 {
+					end = i
+					break scan
+				}
+			case ',':
+				if depth == 1 {
+					commas = append(commas, i)
+				}
+			}
+		}
+		if end < 0 {
+			continue
+		}
+		var items []string
+		if len(commas) > 0 {
+			from := start + 1
+			for _, c := range append(commas, end) {
+				items = append(items, word[from:c])
+				from = c + 1
+			}
+		} else {
+			seq, ok, err := braceRange(word[start+1:end], max)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s", err, word)
+			}
+			if !ok {
+				continue
+			}
+			items = seq
+		}
+		var ret []string
+		for _, item := range items {
+			expanded, err := expandBraces(word[:start]+item+word[end+1:], max-len(ret))
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, expanded...)
+		}
+		return ret, nil
+	}
+	if max < 1 {
+		return nil, fmt.Errorf("%w: %s", ErrBraceExpansionTooLarge, word)
+	}
+	return []string{word}, nil
+}
+
+// braceRange expands the body of a range like {1..5}, {a..e} or {10..1..3}, reporting if it is one.  It fails with
+// ErrBraceExpansionTooLarge rather than give more than max values.
+func braceRange(body string, max int) ([]string, bool, error) {
+	parts := strings.Split(body, "..")
+	if len(parts) != 2 && len(parts) != 3 {
+		return nil, false, nil
+	}
+	step := 1
+	if len(parts) == 3 {
+		var err error
+		if step, err = strconv.Atoi(parts[2]); err != nil {
+			return nil, false, nil
+		}
+	}
+	if from, err := strconv.Atoi(parts[0]); err == nil {
+		to, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return nil, false, nil
+		}
+		width := 0
+		if padded(parts[0]) || padded(parts[1]) {
+			width = len(parts[0])
+			if len(parts[1]) > width {
+				width = len(parts[1])
+			}
+		}
+		values, err := count(from, to, step, max)
+		if err != nil {
+			return nil, true, err
+		}
+		ret := make([]string, 0, len(values))
+		for _, v := range values {
+			s := strconv.Itoa(v)
+			if len(s) < width {
+				digits := strings.TrimPrefix(s, "-")
+				s = s[:len(s)-len(digits)] + strings.Repeat("0", width-len(s)) + digits
+			}
+			ret = append(ret, s)
+		}
+		return ret, true, nil
+	}
+	if len(parts[0]) != 1 || len(parts[1]) != 1 || !isLetter(parts[0][0]) || !isLetter(parts[1][0]) {
+		return nil, false, nil
+	}
+	values, err := count(int(parts[0][0]), int(parts[1][0]), step, max)
+	if err != nil {
+		return nil, true, err
+	}
+	ret := make([]string, 0, len(values))
+	for _, v := range values {
+		ret = append(ret, string(rune(v)))
+	}
+	return ret, true, nil
+}
+
+// count returns from up or down to to, by the size of step, or 1 if it is 0.  It fails with ErrBraceExpansionTooLarge
+// rather than give more than max values.  The arithmetic is unsigned so that ranges reaching the limits of int cannot
+// overflow.
+func count(from, to, step, max int) ([]int, error) {
+	size := uint64(step)
+	if step < 0 {
+		size = -size
+	}
+	if size == 0 {
+		size = 1
+	}
+	span := uint64(to) - uint64(from)
+	if from > to {
+		span = uint64(from) - uint64(to)
+	}
+	if max < 1 || span/size >= uint64(max) {
+		return nil, ErrBraceExpansionTooLarge
+	}
+	ret := make([]int, span/size+1)
+	for i := range ret {
+		if from <= to {
+			ret[i] = int(uint64(from) + uint64(i)*size)
+		} else {
+			ret[i] = int(uint64(from) - uint64(i)*size)
+		}
+	}
+	return ret, nil
+}
+
+// padded reports if the number n is written with leading zeros, which bash keeps the width of.
+func padded(n string) bool {
+	n = strings.TrimPrefix(n, "-")
+	return len(n) > 1 && n[0] == '0'
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
@@ -0,0 +1,74 @@
+package pipe_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/cresta/pipe"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithBraceExpansion(t *testing.T) {
+	var buf bytes.Buffer
+	err := pipe.Shell("echo file.{txt,md}").WithBraceExpansion().Execute(context.Background(), nil, &buf, nil)
+	require.NoError(t, err)
+	require.Equal(t, "file.txt file.md\n", buf.String())
+}
+
+func TestBraceExpansionForms(t *testing.T) {
+	for arg, want := range map[string][]string{
+		"{a,b}":        {"a", "b"},
+		"x{a,b{1,2}}y": {"xay", "xb1y", "xb2y"},
+		"{a,b}{1,2}":   {"a1", "a2", "b1", "b2"},
+		"a{,b}":        {"a", "ab"},
+		"img{1..3}":    {"img1", "img2", "img3"},
+		"{3..1}":       {"3", "2", "1"},
+		"{1..10..4}":   {"1", "5", "9"},
+		"{08..10}":     {"08", "09", "10"},
+		"{a..e..2}":    {"a", "c", "e"},
+		"{a}":          {"{a}"},
+		"{}":           {"{}"},
+		"{a,b":         {"{a,b"},
+		"a,b}":         {"a,b}"},
+		"{1..x}":       {"{1..x}"},
+		"{{a,b}}":      {"{a}", "{b}"},
+		"{x{a,b}":      {"{xa", "{xb"},
+		"{tempdir}":    {"{tempdir}"},
+		"{1..-1..-1}":  {"1", "0", "-1"},
+		"{5..1..0}":    {"5", "4", "3", "2", "1"},
+		"{-01..1}":     {"-01", "000", "001"},
+
+		"{9223372036854775806..9223372036854775807}":   {"9223372036854775806", "9223372036854775807"},
+		"{-9223372036854775807..-9223372036854775808}": {"-9223372036854775807", "-9223372036854775808"},
+		"{-9223372036854775808..9223372036854775807..9223372036854775807}": {
+			"-9223372036854775808", "-1", "9223372036854775806"},
+	} {
+		cmds, err := pipe.NewPiped("echo", arg).WithBraceExpansion().BuildCommands(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, want, cmds[0].Args[1:], arg)
+	}
+}
+
+func TestBraceExpansionOptIn(t *testing.T) {
+	cmds, err := pipe.NewPiped("echo", "{a,b}").BuildCommands(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []string{"{a,b}"}, cmds[0].Args[1:])
+}
+
+func TestBraceExpansionTooLarge(t *testing.T) {
+	for _, arg := range []string{
+		"{1..999999999}",
+		"{-9223372036854775808..9223372036854775807}",
+		"{1..1000}{1..1000}",
+		"{a,b}{1..99999}",
+	} {
+		_, err := pipe.NewPiped("echo", arg).WithBraceExpansion().BuildCommands(context.Background())
+		require.ErrorIs(t, err, pipe.ErrBraceExpansionTooLarge, arg)
+	}
+	_, err := pipe.NewPiped("echo", "{1..50000}", "{1..50001}").WithBraceExpansion().BuildCommands(context.Background())
+	require.ErrorIs(t, err, pipe.ErrBraceExpansionTooLarge)
+	cmds, err := pipe.NewPiped("echo", "{1..100000}").WithBraceExpansion().BuildCommands(context.Background())
+	require.NoError(t, err)
+	require.Len(t, cmds[0].Args, 100001)
+}
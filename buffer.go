@@ -0,0 +1,165 @@
+package pipe
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// WithInterstageBuffering connects the stages of the pipeline through this process instead of directly with OS pipes.
+// Everything a stage writes is held in memory until the next stage reads it, so a fast stage never waits on a slow one,
+// at the cost of that memory.
+func (p *PipedCmd) WithInterstageBuffering() *PipedCmd {
+	return p.setOption(func(o *options) {
+		o.bufferStages = true
+	})
+}
+
+// WithMaxConcurrentStages limits how many stages run at once to n.  The first n stages are started, and only once they
+// have all exited are the next n started, reading what the last of them wrote from memory.  This trades latency, and
+// the memory to hold everything passed between waves, for lower peak resource use in very long pipelines.
+//
+// It only applies with WithInterstageBuffering.  With OS pipes every stage must run at the same time or the pipeline
+// can deadlock, so the limit is ignored.
+func (p *PipedCmd) WithMaxConcurrentStages(n int) *PipedCmd {
+	return p.setOption(func(o *options) {
+		o.maxConcurrentStages = n
+	})
+}
+
+// bufferedLink carries one stage's output to the next through this process, holding as much as it needs to in memory
+// so the upstream never waits on the downstream.  A bounded link instead holds one write at a time, so the upstream
+// waits on the downstream just as it would with an OS pipe.
+type bufferedLink struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	buf     []byte
+	bounded bool
+	// written counts every byte the upstream wrote
+	written int64
+	// closed is set once the upstream is done writing, and broken once the downstream stops reading
+	closed bool
+	broken bool
+	// timer fires if no data is passed to the downstream for too long, once armed
+	timer     *time.Timer
+	idleAfter time.Duration
+	fired     bool
+	// stdin is the downstream's end of the OS pipe pump writes to
+	stdin  *os.File
+	pumped chan struct{}
+}
+
+func newBufferedLink(bounded bool) (*bufferedLink, error) {
+	r, w, err := newPipe()
+	if err != nil {
+		return nil, fmt.Errorf("unable to create pipe: %w", err)
+	}
+	l := &bufferedLink{
+		bounded: bounded,
+		stdin:   r,
+		pumped:  make(chan struct{}),
+	}
+	l.cond = sync.NewCond(&l.mu)
+	go l.pump(w)
+	return l, nil
+}
+
+// Write buffers p for the downstream.  Once the downstream has gone away it fails, which makes os/exec close the pipe
+// the upstream writes to, so it sees a broken pipe just as it would writing to the downstream directly.
+func (l *bufferedLink) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.broken {
+		return 0, io.ErrClosedPipe
+	}
+	l.buf = append(l.buf, p...)
+	l.written += int64(len(p))
+	l.cond.Broadcast()
+	for l.bounded && len(l.buf) > 0 && !l.broken {
+		l.cond.Wait()
+	}
+	if l.broken {
+		return 0, io.ErrClosedPipe
+	}
+	return len(p), nil
+}
+
+func (l *bufferedLink) closeWrite() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed = true
+	l.cond.Broadcast()
+}
+
+// total is how many bytes the upstream has written.
+func (l *bufferedLink) total() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.written
+}
+
+// arm calls onIdle if d passes without any data being passed to the downstream, until the link is done.
+func (l *bufferedLink) arm(d time.Duration, onIdle func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.broken || l.closed && len(l.buf) == 0 {
+		return
+	}
+	l.idleAfter = d
+	l.timer = time.AfterFunc(d, func() {
+		l.mu.Lock()
+		l.fired = true
+		l.mu.Unlock()
+		onIdle()
+	})
+}
+
+// idled reports if the link's timer fired.
+func (l *bufferedLink) idled() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.fired
+}
+
+// pump copies the buffer into w until the upstream is done and everything is written, or the downstream goes away.
+func (l *bufferedLink) pump(w *os.File) {
+	defer close(l.pumped)
+	defer w.Close()
+	defer l.stopTimer()
+	for {
+		l.mu.Lock()
+		for len(l.buf) == 0 && !l.closed {
+			l.cond.Wait()
+		}
+		chunk := l.buf
+		l.buf = nil
+		l.cond.Broadcast()
+		l.mu.Unlock()
+		if len(chunk) == 0 {
+			return
+		}
+		if _, err := w.Write(chunk); err != nil {
+			l.mu.Lock()
+			l.broken = true
+			l.buf = nil
+			l.cond.Broadcast()
+			l.mu.Unlock()
+			return
+		}
+		l.mu.Lock()
+		if l.timer != nil && !l.fired {
+			l.timer.Reset(l.idleAfter)
+		}
+		l.mu.Unlock()
+	}
+}
+
+func (l *bufferedLink) stopTimer() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.timer != nil {
+		l.timer.Stop()
+	}
+}
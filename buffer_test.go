@@ -0,0 +1,56 @@
+package pipe_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cresta/pipe"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInterstageBuffering(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, pipe.Shell("seq 1 100000").Pipe("wc", "-l").WithInterstageBuffering().Execute(context.Background(), nil, &buf, nil))
+	require.Equal(t, "100000", strings.TrimSpace(buf.String()))
+}
+
+func TestInterstageBufferingDownstreamExitsEarly(t *testing.T) {
+	var buf bytes.Buffer
+	err := pipe.Shell("yes").Pipe("head", "-n", "1").WithInterstageBuffering().Execute(context.Background(), nil, &buf, nil)
+	// Like with OS pipes, yes is killed by SIGPIPE
+	require.Error(t, err)
+	require.Equal(t, "y\n", buf.String())
+}
+
+func TestMaxConcurrentStages(t *testing.T) {
+	log := filepath.Join(t.TempDir(), "log")
+	stage := func(i int) *pipe.PipedCmd {
+		return pipe.NewPiped("sh", "-c", fmt.Sprintf("echo start %[1]d >> %[2]s; sleep 0.1; cat; echo %[1]d; echo end %[1]d >> %[2]s", i, log))
+	}
+	p := stage(0).PipeTo(stage(1)).PipeTo(stage(2)).WithInterstageBuffering().WithMaxConcurrentStages(1)
+	var buf bytes.Buffer
+	require.NoError(t, p.Execute(context.Background(), nil, &buf, nil))
+	require.Equal(t, "0\n1\n2\n", buf.String())
+	content, err := os.ReadFile(log)
+	require.NoError(t, err)
+	require.Equal(t, "start 0\nend 0\nstart 1\nend 1\nstart 2\nend 2\n", string(content))
+}
+
+func TestMaxConcurrentStagesStartFailure(t *testing.T) {
+	var exited []int
+	err := pipe.Shell("echo hi").Pipe("cat").Pipe("/does/not/exist").Pipe("cat").
+		WithInterstageBuffering().
+		WithMaxConcurrentStages(2).
+		WithStageExitCallback(func(stage int, code int, err error) {
+			exited = append(exited, stage)
+		}).
+		Execute(context.Background(), nil, nil, nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "unable to start command")
+	require.Equal(t, []int{0, 1}, exited)
+}
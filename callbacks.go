@@ -0,0 +1,58 @@
+package pipe
+
+// WithStageExitCallback calls f as each stage exits, in the order they exit, with the stage's index (zero is the head
+// of the pipeline), its exit code and the error from waiting on it.  The code is -1 if the stage did not exit
+// normally, for example if it was killed by a signal.  f is called exactly once for every stage that started.
+//
+// f is called from the goroutines waiting on the stages, not the one running the pipeline, but never for two stages
+// at once.
+func (p *PipedCmd) WithStageExitCallback(f func(stage int, code int, err error)) *PipedCmd {
+	return p.setOption(func(o *options) {
+		o.onStageExit = f
+	})
+}
+
+// WithNotFoundHandler calls f with the name of any command that cannot be found in PATH, before failing the pipeline.
+// If f returns nil the command is looked up once more, so f can install the missing tool and let the pipeline carry
+// on.  If f returns an error, the pipeline fails with it instead of the usual not found error, which lets f explain
+// how to fix the problem, for example "jq is not installed: run brew install jq".
+func (p *PipedCmd) WithNotFoundHandler(f func(cmd string) error) *PipedCmd {
+	return p.setOption(func(o *options) {
+		o.onNotFound = f
+	})
+}
+
+// WithEmptyOutputWarning calls f with the index of each stage that exited successfully without writing anything to
+// its stdout, to surface commands that fail silently, like a query that matched nothing or a misconfigured tool.  It
+// is advisory: the pipeline's result is not changed.
+//
+// The last stage is always watched.  Earlier stages write straight into the next through an OS pipe this process never
+// sees, so they are only watched with WithInterstageBuffering or WithPipeReadTimeout, and never when they are piped
+// with PipeStderrTo.  f is called once the pipeline is done, head first, before Execute returns.
+func (p *PipedCmd) WithEmptyOutputWarning(f func(stage int)) *PipedCmd {
+	return p.setOption(func(o *options) {
+		o.onEmptyOutput = f
+	})
+}
+
+// warnEmptyOutput calls the empty output warning for the stages that succeeded without writing anything.
+func (e *execution) warnEmptyOutput() {
+	if e.opts.onEmptyOutput == nil {
+		return
+	}
+	for i, r := range e.runs {
+		if r.outcome != StageSuccess {
+			continue
+		}
+		switch {
+		case i == len(e.runs)-1:
+			if e.written.n.Load() == 0 {
+				e.opts.onEmptyOutput(i)
+			}
+		case e.links != nil && !r.stderrPiped:
+			if e.links[i].total() == 0 {
+				e.opts.onEmptyOutput(i)
+			}
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package pipe_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"testing"
+
+	"github.com/cresta/pipe"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStageExitCallback(t *testing.T) {
+	var exits []string
+	err := pipe.NewPiped("sh", "-c", "echo hi; exit 3").
+		Pipe("sh", "-c", "sleep 0.2; cat").
+		WithStageExitCallback(func(stage int, code int, err error) {
+			exits = append(exits, fmt.Sprintf("%d:%d:%v", stage, code, err != nil))
+		}).
+		Execute(context.Background(), nil, nil, nil)
+	require.Error(t, err)
+	require.Equal(t, []string{"0:3:true", "1:0:false"}, exits)
+}
+
+func TestStageExitCallbackStartFailure(t *testing.T) {
+	var stages []int
+	err := pipe.Shell("echo hi").Pipe("/does/not/exist").
+		WithStageExitCallback(func(stage int, code int, err error) {
+			stages = append(stages, stage)
+		}).
+		Run(context.Background())
+	require.Error(t, err)
+	require.Equal(t, []int{0}, stages)
+}
+
+func TestNotFoundHandlerInstalls(t *testing.T) {
+	dir := t.TempDir()
+	var missing []string
+	var buf bytes.Buffer
+	err := pipe.NewPiped("pipe-test-tool").PrependPath(dir).
+		WithNotFoundHandler(func(cmd string) error {
+			missing = append(missing, cmd)
+			writeScript(t, dir, cmd, "echo installed")
+			return nil
+		}).
+		Execute(context.Background(), nil, &buf, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"pipe-test-tool"}, missing)
+	require.Equal(t, "installed\n", buf.String())
+}
+
+func TestNotFoundHandlerError(t *testing.T) {
+	guided := errors.New("pipe-test-tool is not installed: run make tools")
+	err := pipe.NewPiped("pipe-test-tool").
+		WithNotFoundHandler(func(cmd string) error {
+			return guided
+		}).
+		Run(context.Background())
+	require.ErrorIs(t, err, guided)
+}
+
+func TestNotFoundWithoutHandler(t *testing.T) {
+	err := pipe.NewPiped("pipe-test-tool").Run(context.Background())
+	require.ErrorIs(t, err, exec.ErrNotFound)
+}
+
+func TestEmptyOutputWarning(t *testing.T) {
+	var warned []int
+	err := pipe.NewPiped("true").Pipe("cat").WithEmptyOutputWarning(func(stage int) {
+		warned = append(warned, stage)
+	}).Execute(context.Background(), nil, nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, []int{1}, warned)
+}
+
+func TestEmptyOutputWarningBuffered(t *testing.T) {
+	var warned []int
+	err := pipe.NewPiped("true").Pipe("echo", "hi").Pipe("cat").WithInterstageBuffering().
+		WithEmptyOutputWarning(func(stage int) {
+			warned = append(warned, stage)
+		}).Execute(context.Background(), nil, nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, []int{0}, warned)
+}
+
+func TestEmptyOutputWarningNotOnFailure(t *testing.T) {
+	var warned []int
+	err := pipe.NewPiped("false").WithEmptyOutputWarning(func(stage int) {
+		warned = append(warned, stage)
+	}).Execute(context.Background(), nil, nil, nil)
+	require.Error(t, err)
+	require.Empty(t, warned)
+}
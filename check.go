@@ -0,0 +1,96 @@
+package pipe
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// checkTailLines is how many of the last lines of stderr Check puts in its error.
+const checkTailLines = 10
+
+// Check runs the pipeline like Run and, if it fails, returns an error that says clearly what went wrong: the command
+// line, as Quoted renders it, the error, and the last lines the pipeline wrote to stderr.  Its stderr still goes to
+// this process's stderr as it is written.  It is the opinionated default for scripts that just need to know if a
+// command worked; Execute and PipelineError give the detail for custom handling.
+//
+//	if err := pipe.Shell("terraform apply -auto-approve").Check(ctx); err != nil {
+//		log.Fatal(err)
+//	}
+func (p *PipedCmd) Check(ctx context.Context) error {
+	tail := newLineRing(checkTailLines)
+	err := p.Execute(ctx, nil, p.defaultStdout(), io.MultiWriter(os.Stderr, tail))
+	if err == nil {
+		return nil
+	}
+	if t := tail.String(); t != "" {
+		return fmt.Errorf("%s failed: %w\nlast lines of stderr:\n%s", p.Quoted(), err, strings.TrimSuffix(t, "\n"))
+	}
+	return fmt.Errorf("%s failed: %w", p.Quoted(), err)
+}
+
+// maxRingLine is the most of one line a lineRing keeps, so output without newlines cannot use unbounded memory.
+const maxRingLine = 4096
+
+// lineRing is a writer that keeps only the last lines written to it.
+type lineRing struct {
+	mu    sync.Mutex
+	lines [][]byte
+	next  int
+	full  bool
+	// partial is the last line, if it has no newline yet
+	partial []byte
+}
+
+func newLineRing(n int) *lineRing {
+	return &lineRing{lines: make([][]byte, n)}
+}
+
+func (r *lineRing) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rest := p
+	for len(rest) > 0 {
+		i := bytes.IndexByte(rest, '\n')
+		if i < 0 {
+			r.partial = truncateLine(append(r.partial, rest...))
+			break
+		}
+		line := truncateLine(append(r.partial, rest[:i+1]...))
+		r.partial = nil
+		r.lines[r.next] = line
+		r.next = (r.next + 1) % len(r.lines)
+		r.full = r.full || r.next == 0
+		rest = rest[i+1:]
+	}
+	return len(p), nil
+}
+
+// truncateLine keeps the end of line if it is longer than maxRingLine.
+func truncateLine(line []byte) []byte {
+	if len(line) <= maxRingLine {
+		return line
+	}
+	return append([]byte(nil), line[len(line)-maxRingLine:]...)
+}
+
+// String returns the lines kept, oldest first.
+func (r *lineRing) String() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var b strings.Builder
+	if r.full {
+		for _, line := range r.lines[r.next:] {
+			b.Write(line)
+		}
+	}
+	for _, line := range r.lines[:r.next] {
+		b.Write(line)
+	}
+	b.Write(r.partial)
+	return b.String()
+}
@@ -0,0 +1,37 @@
+package pipe_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/cresta/pipe"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheck(t *testing.T) {
+	require.NoError(t, pipe.NewPiped("true").Check(context.Background()))
+}
+
+func TestCheckTo(t *testing.T) {
+	var out bytes.Buffer
+	require.NoError(t, pipe.NewPiped("echo", "hi").To(&out).Check(context.Background()))
+	require.Equal(t, "hi\n", out.String())
+}
+
+func TestCheckFailure(t *testing.T) {
+	err := pipe.NewPiped("sh", "-c", "for i in $(seq 1 20); do echo line$i >&2; done; exit 2").
+		Check(context.Background())
+	require.Error(t, err)
+	msg := err.Error()
+	require.True(t, strings.HasPrefix(msg, `sh -c 'for i in $(seq 1 20); do echo line$i >&2; done; exit 2' failed: `), msg)
+	require.Contains(t, msg, "exit status 2")
+	require.True(t, strings.HasSuffix(msg, "last lines of stderr:\nline11\nline12\nline13\nline14\nline15\nline16\nline17\nline18\nline19\nline20"), msg)
+	require.Equal(t, 2, pipe.ExitCodeOf(err))
+}
+
+func TestCheckFailureWithoutStderr(t *testing.T) {
+	err := pipe.NewPiped("echo", "hi").Pipe("false").Check(context.Background())
+	require.EqualError(t, err, "echo hi | false failed: stage 1 false: exit status 1")
+}
@@ -0,0 +1,27 @@
+package pipe
+
+import "fmt"
+
+// WithAccurateCombinedOutput sends the stderr of every stage, along with the last stage's stdout, to the pipeline's
+// stdout through one OS pipe, like the shell's "(a | b) 2>&1".  The stages write to the same file, so the kernel keeps
+// their writes in the order they were made, where merging separate stdout and stderr writers can reorder them.  The
+// stderr given to Execute is not used.  Stages piped with PipeStderrTo still send their stderr to the next stage.
+//
+// With WithForceTTY, stderr is written to the terminal instead, as it would be when run interactively.
+func (p *PipedCmd) WithAccurateCombinedOutput() *PipedCmd {
+	return p.setOption(func(o *options) {
+		o.combinedOutput = true
+	})
+}
+
+// newCombinedOutput makes the pipe the stages write their combined output to.
+func newCombinedOutput() (*copiedOutput, error) {
+	r, w, err := newPipe()
+	if err != nil {
+		return nil, fmt.Errorf("unable to create pipe: %w", err)
+	}
+	return &copiedOutput{
+		write: w,
+		read:  r,
+	}, nil
+}
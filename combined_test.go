@@ -0,0 +1,38 @@
+package pipe_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/cresta/pipe"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccurateCombinedOutput(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	script := "for i in 1 2 3 4 5; do echo out$i; echo err$i >&2; done"
+	err := pipe.NewPiped("sh", "-c", script).WithAccurateCombinedOutput().
+		Execute(context.Background(), nil, &stdout, &stderr)
+	require.NoError(t, err)
+	require.Equal(t, "out1\nerr1\nout2\nerr2\nout3\nerr3\nout4\nerr4\nout5\nerr5\n", stdout.String())
+	require.Empty(t, stderr.String())
+}
+
+func TestAccurateCombinedOutputEarlierStages(t *testing.T) {
+	var stdout bytes.Buffer
+	err := pipe.NewPiped("sh", "-c", "echo warning >&2; echo data").
+		Pipe("sh", "-c", "read line; echo got $line").WithAccurateCombinedOutput().
+		Execute(context.Background(), nil, &stdout, nil)
+	require.NoError(t, err)
+	require.Equal(t, "warning\ngot data\n", stdout.String())
+}
+
+func TestAccurateCombinedOutputWaves(t *testing.T) {
+	var stdout bytes.Buffer
+	err := pipe.NewPiped("echo", "hi").Pipe("cat").Pipe("sh", "-c", "cat; echo done >&2").
+		WithInterstageBuffering().WithMaxConcurrentStages(1).WithAccurateCombinedOutput().
+		Execute(context.Background(), nil, &stdout, nil)
+	require.NoError(t, err)
+	require.Equal(t, "hi\ndone\n", stdout.String())
+}
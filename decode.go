@@ -0,0 +1,65 @@
+package pipe
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// A Decoder parses a pipeline's output into v.  json.Unmarshal and yaml.Unmarshal both have this shape.
+type Decoder func(data []byte, v interface{}) error
+
+var (
+	// JSONDecoder decodes output with encoding/json.  It is the default for Decode.
+	JSONDecoder Decoder = json.Unmarshal
+	// YAMLDecoder decodes output with gopkg.in/yaml.v3.
+	YAMLDecoder Decoder = yaml.Unmarshal
+	// GobDecoder decodes output with encoding/gob.
+	GobDecoder Decoder = func(data []byte, v interface{}) error {
+		return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+	}
+)
+
+// maxSnippet is how much output is quoted in decode errors
+const maxSnippet = 256
+
+// WithDecoder sets the Decoder used by Decode.
+func (p *PipedCmd) WithDecoder(d Decoder) *PipedCmd {
+	return p.setOption(func(o *options) {
+		o.decoder = d
+	})
+}
+
+// Decode runs the pipeline and decodes its stdout into v, by default as JSON.  This is the "run a tool, parse its
+// output" pattern in one step
+//
+//	var pods PodList
+//	err := Shell("kubectl get pods -o json").Decode(ctx, &pods)
+//
+// Decode errors include the start of the output to help debugging.
+func (p *PipedCmd) Decode(ctx context.Context, v interface{}) error {
+	var buf bytes.Buffer
+	if err := p.Execute(ctx, nil, &buf, os.Stderr); err != nil {
+		return err
+	}
+	decoder := p.options().decoder
+	if decoder == nil {
+		decoder = JSONDecoder
+	}
+	if err := decoder(buf.Bytes(), v); err != nil {
+		return fmt.Errorf("unable to decode output %q: %w", snippet(buf.Bytes()), err)
+	}
+	return nil
+}
+
+func snippet(b []byte) string {
+	if len(b) <= maxSnippet {
+		return string(b)
+	}
+	return string(b[:maxSnippet]) + "..."
+}
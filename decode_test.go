@@ -0,0 +1,33 @@
+package pipe_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cresta/pipe"
+	"github.com/stretchr/testify/require"
+)
+
+type decoded struct {
+	Name  string `json:"name" yaml:"name"`
+	Count int    `json:"count" yaml:"count"`
+}
+
+func TestDecodeJSON(t *testing.T) {
+	var v decoded
+	require.NoError(t, pipe.NewPiped("echo", `{"name": "a", "count": 2}`).Decode(context.Background(), &v))
+	require.Equal(t, decoded{Name: "a", Count: 2}, v)
+}
+
+func TestDecodeYAML(t *testing.T) {
+	var v decoded
+	require.NoError(t, pipe.NewPiped("printf", "name: b\\ncount: 3\\n").WithDecoder(pipe.YAMLDecoder).Decode(context.Background(), &v))
+	require.Equal(t, decoded{Name: "b", Count: 3}, v)
+}
+
+func TestDecodeErrorIncludesOutput(t *testing.T) {
+	var v decoded
+	err := pipe.NewPiped("echo", "not json").Decode(context.Background(), &v)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "not json")
+}
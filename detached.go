@@ -0,0 +1,25 @@
+package pipe
+
+import (
+	"context"
+	"os"
+)
+
+// RunDetached starts the pipeline like Run but returns as soon as every command has started.  The commands are waited
+// on by a background goroutine that exits once they do, so cancelling ctx still kills the pipeline and ends the
+// goroutine.
+//
+// Only errors starting the pipeline are returned.  Once started, failures are reported to the logger set with
+// WithLogger, never to the caller.
+func (p *PipedCmd) RunDetached(ctx context.Context) error {
+	e, err := p.start(ctx, nil, p.defaultStdout(), os.Stderr)
+	if err != nil {
+		return err
+	}
+	go func() {
+		if err := e.wait(); err != nil {
+			e.opts.log().Printf("detached pipeline %s failed: %v", p.describe(), err)
+		}
+	}()
+	return nil
+}
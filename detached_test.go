@@ -0,0 +1,58 @@
+package pipe_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/cresta/pipe"
+	"github.com/stretchr/testify/require"
+)
+
+type chanLogger chan string
+
+func (c chanLogger) Printf(format string, v ...interface{}) {
+	c <- fmt.Sprintf(format, v...)
+}
+
+func TestRunDetached(t *testing.T) {
+	logs := make(chanLogger, 1)
+	start := time.Now()
+	require.NoError(t, pipe.Shell("sh -c 'sleep 0.2; exit 3'").WithLogger(logs).RunDetached(context.Background()))
+	require.Less(t, time.Since(start), 200*time.Millisecond)
+	select {
+	case msg := <-logs:
+		require.Contains(t, msg, "exit status 3")
+	case <-time.After(5 * time.Second):
+		t.Fatal("detached failure was never logged")
+	}
+}
+
+func TestRunDetachedStartError(t *testing.T) {
+	require.Error(t, pipe.NewPiped("/does/not/exist").RunDetached(context.Background()))
+}
+
+func TestRunDetachedCancel(t *testing.T) {
+	logs := make(chanLogger, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	require.NoError(t, pipe.Shell("sleep 10").WithLogger(logs).RunDetached(ctx))
+	cancel()
+	select {
+	case msg := <-logs:
+		require.Contains(t, msg, "sleep")
+	case <-time.After(5 * time.Second):
+		t.Fatal("cancelled pipeline was never reaped")
+	}
+}
+
+func TestRunDetachedTo(t *testing.T) {
+	r, w := io.Pipe()
+	defer r.Close()
+	require.NoError(t, pipe.NewPiped("echo", "hi").To(w).RunDetached(context.Background()))
+	out := make([]byte, 3)
+	_, err := io.ReadFull(r, out)
+	require.NoError(t, err)
+	require.Equal(t, "hi\n", string(out))
+}
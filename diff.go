@@ -0,0 +1,47 @@
+package pipe
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// RunDiff runs the pipeline and returns a unified diff from expected to what the pipeline wrote to stdout, or the
+// empty string if they are the same.  It is meant for golden file tests of command output
+//
+//	diff, err := Shell("mytool --version").RunDiff(ctx, golden)
+//	require.NoError(t, err)
+//	require.Empty(t, diff)
+//
+// If the pipeline fails its error is returned along with the diff of whatever output it wrote before failing.
+func (p *PipedCmd) RunDiff(ctx context.Context, expected string) (string, error) {
+	var buf bytes.Buffer
+	runErr := p.Execute(ctx, nil, &buf, os.Stderr)
+	if buf.String() == expected {
+		return "", runErr
+	}
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        splitLines(expected),
+		B:        splitLines(buf.String()),
+		FromFile: "expected",
+		ToFile:   "actual",
+		Context:  3,
+	})
+	if err != nil {
+		return "", err
+	}
+	return diff, runErr
+}
+
+// splitLines splits s into lines keeping their line endings.  difflib.SplitLines would add an empty line to the end of
+// text ending in a newline.
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
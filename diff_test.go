@@ -0,0 +1,21 @@
+package pipe_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cresta/pipe"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunDiffSame(t *testing.T) {
+	diff, err := pipe.Shell("printf 'a\\nb\\n'").RunDiff(context.Background(), "a\nb\n")
+	require.NoError(t, err)
+	require.Empty(t, diff)
+}
+
+func TestRunDiffDifferent(t *testing.T) {
+	diff, err := pipe.Shell("printf 'a\\nc\\n'").RunDiff(context.Background(), "a\nb\n")
+	require.NoError(t, err)
+	require.Equal(t, "--- expected\n+++ actual\n@@ -1,2 +1,2 @@\n a\n-b\n+c\n", diff)
+}
@@ -0,0 +1,73 @@
+package pipe
+
+import "fmt"
+
+// InsertStage splices a new stage running cmd into the pipeline at index, so it reads from the stage before it and
+// writes to the stage that was there.  Index zero makes it the new head, and the number of stages makes it the new
+// tail.  It returns the tail of the pipeline, and panics if index is out of range.
+//
+//	Shell("find .").Pipe("sort").InsertStage(1, "grep", "-v", ".git")
+func (p *PipedCmd) InsertStage(index int, cmd string, args ...string) *PipedCmd {
+	stages := p.allStages()
+	if index < 0 || index > len(stages) {
+		panic(fmt.Sprintf("stage index %d out of range for a pipeline of %d stages", index, len(stages)))
+	}
+	if err := checkStages(len(stages) + 1); err != nil {
+		panic(err)
+	}
+	s := &PipedCmd{
+		cmd:  cmd,
+		args: args,
+	}
+	if index > 0 {
+		s.readFrom = stages[index-1]
+		stages[index-1].pipeTo = s
+	}
+	if index < len(stages) {
+		s.pipeTo = stages[index]
+		stages[index].readFrom = s
+	}
+	return s.tail()
+}
+
+// RemoveStage takes the stage at index out of the pipeline, so the stage before it feeds the stage after it directly.
+// Pipeline-wide options set on the removed stage go with it.  It returns the tail of the pipeline, and panics if index
+// is out of range or the stage is the only one.
+func (p *PipedCmd) RemoveStage(index int) *PipedCmd {
+	stages := p.allStages()
+	if index < 0 || index >= len(stages) {
+		panic(fmt.Sprintf("stage index %d out of range for a pipeline of %d stages", index, len(stages)))
+	}
+	if len(stages) == 1 {
+		panic("cannot remove the only stage of a pipeline")
+	}
+	s := stages[index]
+	upstream, downstream := s.readFrom, s.pipeTo
+	if upstream != nil {
+		upstream.pipeTo = downstream
+		if downstream == nil {
+			upstream.pipeStderr = false
+		}
+	}
+	if downstream != nil {
+		downstream.readFrom = upstream
+	}
+	s.readFrom, s.pipeTo = nil, nil
+	if downstream != nil {
+		return downstream.tail()
+	}
+	return upstream
+}
+
+// allStages returns every stage of the pipeline p is part of, head first, including any after p.
+func (p *PipedCmd) allStages() []*PipedCmd {
+	return p.tail().stages()
+}
+
+func (p *PipedCmd) tail() *PipedCmd {
+	t := p
+	for t.pipeTo != nil {
+		t = t.pipeTo
+	}
+	return t
+}
@@ -0,0 +1,64 @@
+package pipe_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/cresta/pipe"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInsertStage(t *testing.T) {
+	p := pipe.NewPiped("printf", "b\\na\\nc\\n").Pipe("sort")
+	p = p.InsertStage(1, "grep", "-v", "c")
+	var buf bytes.Buffer
+	require.NoError(t, p.Execute(context.Background(), nil, &buf, nil))
+	require.Equal(t, "a\nb\n", buf.String())
+	require.Equal(t, `printf 'b\na\nc\n' | grep -v c | sort`, p.Quoted())
+}
+
+func TestInsertStageEnds(t *testing.T) {
+	p := pipe.NewPiped("sort").
+		InsertStage(0, "printf", "b\\na\\n").
+		InsertStage(2, "head", "-n", "1")
+	var buf bytes.Buffer
+	require.NoError(t, p.Execute(context.Background(), nil, &buf, nil))
+	require.Equal(t, "a\n", buf.String())
+}
+
+func TestInsertStageOutOfRange(t *testing.T) {
+	require.Panics(t, func() {
+		pipe.NewPiped("cat").InsertStage(2, "sort")
+	})
+	require.Panics(t, func() {
+		pipe.NewPiped("cat").InsertStage(-1, "sort")
+	})
+}
+
+func TestRemoveStage(t *testing.T) {
+	p := pipe.NewPiped("printf", "b\\na\\nc\\n").Pipe("grep", "-v", "c").Pipe("sort")
+	p = p.RemoveStage(1)
+	require.Equal(t, `printf 'b\na\nc\n' | sort`, p.Quoted())
+	var buf bytes.Buffer
+	require.NoError(t, p.Execute(context.Background(), nil, &buf, nil))
+	require.Equal(t, "a\nb\nc\n", buf.String())
+}
+
+func TestRemoveStageEnds(t *testing.T) {
+	p := pipe.NewPiped("echo", "ignored").Pipe("printf", "b\\na\\n").Pipe("sort").Pipe("head", "-n", "1")
+	p = p.RemoveStage(0).RemoveStage(2)
+	require.Equal(t, `printf 'b\na\n' | sort`, p.Quoted())
+	var buf bytes.Buffer
+	require.NoError(t, p.Execute(context.Background(), nil, &buf, nil))
+	require.Equal(t, "a\nb\n", buf.String())
+}
+
+func TestRemoveStageOutOfRange(t *testing.T) {
+	require.Panics(t, func() {
+		pipe.NewPiped("cat").Pipe("sort").RemoveStage(2)
+	})
+	require.Panics(t, func() {
+		pipe.NewPiped("cat").RemoveStage(0)
+	})
+}
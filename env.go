@@ -0,0 +1,195 @@
+package pipe
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// WithEnvVar sets key to value in the stage's environment, on top of the environment it would otherwise run with.  If
+// that environment already sets key, the assignment made here wins unless WithEnvConflictPolicy says otherwise.
+func (p *PipedCmd) WithEnvVar(key, value string) *PipedCmd {
+	p.envEdits = append(p.envEdits, func(env []string) []string {
+		return append(env, key+"="+value)
+	})
+	return p
+}
+
+// ErrEnvConflict is returned, wrapped, when a stage's environment sets a variable twice under EnvConflictError.
+var ErrEnvConflict = errors.New("environment variable set more than once")
+
+// EnvConflictPolicy says what happens when a stage's environment assigns the same variable more than once, as it does
+// when WithEnvVar sets a variable the stage would otherwise inherit, or a Shell line assigns one twice.
+type EnvConflictPolicy int
+
+const (
+	// EnvLastWins uses the last assignment, the way exec.Cmd does.  It is the default.
+	EnvLastWins EnvConflictPolicy = iota
+	// EnvConflictError fails the pipeline, before anything is run, if any stage assigns a variable two different
+	// values, so a critical variable is never silently overridden.
+	EnvConflictError
+)
+
+// WithEnvConflictPolicy sets how the pipeline treats variables assigned more than once in a stage's environment.
+func (p *PipedCmd) WithEnvConflictPolicy(policy EnvConflictPolicy) *PipedCmd {
+	return p.setOption(func(o *options) {
+		o.envConflict = policy
+	})
+}
+
+// envConflict returns an error naming the first variable env assigns two different values.
+func envConflict(env []string) error {
+	seen := make(map[string]string, len(env))
+	for _, e := range env {
+		k, v, found := strings.Cut(e, "=")
+		if !found {
+			continue
+		}
+		if runtime.GOOS == "windows" {
+			k = strings.ToUpper(k)
+		}
+		if previous, exists := seen[k]; exists && previous != v {
+			return fmt.Errorf("%w: %s is both %q and %q", ErrEnvConflict, k, previous, v)
+		}
+		seen[k] = v
+	}
+	return nil
+}
+
+// WithEnvRewriter has f make the final adjustments to the environment of every stage, such as sorting or filtering it
+// or injecting a freshly minted token.  f is called once per stage, just before it is run, with a copy of the fully
+// computed environment, after inheritance from this process and every other environment option, and whatever it
+// returns is the environment the stage runs with, so returning nil runs it with an empty one.  It is the last word on
+// the environment.
+func (p *PipedCmd) WithEnvRewriter(f func(env []string) []string) *PipedCmd {
+	return p.setOption(func(o *options) {
+		o.envRewriter = f
+	})
+}
+
+// WithEnvDefault sets key to value only if the environment the stage would otherwise run with does not already set key,
+// like the shell's ${key=value}.  A key set to the empty string counts as set and is kept.  It gives a default without
+// clobbering a value the user provided.  Edits apply in order, so a WithEnvVar made before this one counts as already
+// set, and one made after it still wins.
+func (p *PipedCmd) WithEnvDefault(key, value string) *PipedCmd {
+	p.envEdits = append(p.envEdits, func(env []string) []string {
+		if _, exists := getEnv(env, key); exists {
+			return env
+		}
+		return append(env, key+"="+value)
+	})
+	return p
+}
+
+// PrependPath adds dirs to the front of the stage's PATH, so programs in them win over ones of the same name later in
+// PATH.  The PATH the stage would otherwise run with, inherited from this process if the stage's environment does not
+// set one, is kept after them.
+func (p *PipedCmd) PrependPath(dirs ...string) *PipedCmd {
+	return p.editPath(func(path string) string {
+		return joinPath(append(append([]string(nil), dirs...), path)...)
+	})
+}
+
+// AppendPath adds dirs to the end of the stage's PATH, so they are only searched after the PATH the stage would
+// otherwise run with.
+func (p *PipedCmd) AppendPath(dirs ...string) *PipedCmd {
+	return p.editPath(func(path string) string {
+		return joinPath(append([]string{path}, dirs...)...)
+	})
+}
+
+func (p *PipedCmd) editPath(f func(path string) string) *PipedCmd {
+	p.envEdits = append(p.envEdits, func(env []string) []string {
+		path, exists := getEnv(env, "PATH")
+		if !exists {
+			path = os.Getenv("PATH")
+		}
+		return setEnv(env, "PATH", f(path))
+	})
+	return p
+}
+
+// environ returns the environment the stage runs with.  nil means the stage inherits the environment of this process,
+// like exec.Cmd.  Edits, such as PrependPath, are applied in the order they were made on top of the stage's
+// environment, or on top of this process's environment if the stage has none.
+func (p *PipedCmd) environ() []string {
+	if len(p.envEdits) == 0 {
+		return p.env
+	}
+	env := p.env
+	if env == nil {
+		env = os.Environ()
+	}
+	env = append([]string(nil), env...)
+	for _, edit := range p.envEdits {
+		env = edit(env)
+	}
+	return env
+}
+
+// resolveCommand finds the program a stage runs.  Programs without a path are looked up in the stage's own PATH when
+// it differs from ours, since exec.Command only ever searches this process's PATH.
+func resolveCommand(name string, env []string) (string, error) {
+	path, exists := getEnv(env, "PATH")
+	if !exists || path == os.Getenv("PATH") || strings.ContainsAny(name, `/\`) {
+		return name, nil
+	}
+	for _, dir := range filepath.SplitList(path) {
+		if dir == "" {
+			continue
+		}
+		candidate := filepath.Join(dir, name)
+		if !strings.ContainsRune(candidate, filepath.Separator) {
+			candidate = "." + string(filepath.Separator) + candidate
+		}
+		if found, err := exec.LookPath(candidate); err == nil {
+			return found, nil
+		}
+	}
+	return name, &exec.Error{Name: name, Err: exec.ErrNotFound}
+}
+
+func envKeyEqual(a, b string) bool {
+	if runtime.GOOS == "windows" {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+// getEnv returns the value of key in env.  Like exec.Cmd, the last assignment wins.
+func getEnv(env []string, key string) (string, bool) {
+	for i := len(env) - 1; i >= 0; i-- {
+		k, v, found := strings.Cut(env[i], "=")
+		if found && envKeyEqual(k, key) {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// setEnv replaces every assignment of key in env with key=value.
+func setEnv(env []string, key, value string) []string {
+	ret := env[:0]
+	for _, e := range env {
+		k, _, found := strings.Cut(e, "=")
+		if found && envKeyEqual(k, key) {
+			continue
+		}
+		ret = append(ret, e)
+	}
+	return append(ret, key+"="+value)
+}
+
+func joinPath(dirs ...string) string {
+	nonEmpty := make([]string, 0, len(dirs))
+	for _, d := range dirs {
+		if d != "" {
+			nonEmpty = append(nonEmpty, d)
+		}
+	}
+	return strings.Join(nonEmpty, string(os.PathListSeparator))
+}
@@ -0,0 +1,131 @@
+package pipe_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cresta/pipe"
+	"github.com/stretchr/testify/require"
+)
+
+func writeScript(t *testing.T, dir string, name string, body string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+body+"\n"), 0700))
+}
+
+func TestPrependPath(t *testing.T) {
+	dir := t.TempDir()
+	writeScript(t, dir, "echo", "printf 'local %s\\n' \"$*\"")
+	var buf bytes.Buffer
+	require.NoError(t, pipe.NewPiped("echo", "hi").PrependPath(dir).Execute(context.Background(), nil, &buf, nil))
+	require.Equal(t, "local hi\n", buf.String())
+}
+
+func TestAppendPath(t *testing.T) {
+	dir := t.TempDir()
+	writeScript(t, dir, "echo", "printf 'local %s\\n' \"$*\"")
+	writeScript(t, dir, "only-local", "echo only local")
+	var buf bytes.Buffer
+	require.NoError(t, pipe.NewPiped("echo", "hi").AppendPath(dir).Execute(context.Background(), nil, &buf, nil))
+	require.Equal(t, "hi\n", buf.String())
+
+	buf.Reset()
+	require.NoError(t, pipe.NewPiped("only-local").AppendPath(dir).Execute(context.Background(), nil, &buf, nil))
+	require.Equal(t, "only local\n", buf.String())
+}
+
+func TestPrependPathKeepsInheritedPath(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, pipe.Shell("FOO=bar env").PrependPath("/does/not/exist").Execute(context.Background(), nil, &buf, nil))
+	require.Contains(t, buf.String(), "PATH=/does/not/exist"+string(os.PathListSeparator)+os.Getenv("PATH")+"\n")
+	require.Contains(t, buf.String(), "FOO=bar\n")
+}
+
+func TestWithEnvDefault(t *testing.T) {
+	t.Setenv("PIPE_TEST_SET", "from user")
+	var buf bytes.Buffer
+	require.NoError(t, pipe.NewPiped("sh", "-c", "echo $PIPE_TEST_SET; echo $PIPE_TEST_UNSET").
+		WithEnvDefault("PIPE_TEST_SET", "default").
+		WithEnvDefault("PIPE_TEST_UNSET", "default").
+		Execute(context.Background(), nil, &buf, nil))
+	require.Equal(t, "from user\ndefault\n", buf.String())
+}
+
+func TestWithEnvDefaultAndWithEnvVar(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, pipe.NewPiped("sh", "-c", "echo $A $B").
+		WithEnvVar("A", "explicit").
+		WithEnvDefault("A", "default").
+		WithEnvDefault("B", "default").
+		WithEnvVar("B", "explicit").
+		Execute(context.Background(), nil, &buf, nil))
+	require.Equal(t, "explicit explicit\n", buf.String())
+}
+
+func TestEnvConflictPolicy(t *testing.T) {
+	t.Setenv("PIPE_TEST_CRITICAL", "inherited")
+	build := func() *pipe.PipedCmd {
+		return pipe.NewPiped("sh", "-c", "echo $PIPE_TEST_CRITICAL").WithEnvVar("PIPE_TEST_CRITICAL", "override")
+	}
+	var buf bytes.Buffer
+	require.NoError(t, build().Execute(context.Background(), nil, &buf, nil))
+	require.Equal(t, "override\n", buf.String())
+
+	buf.Reset()
+	require.NoError(t, build().WithEnvConflictPolicy(pipe.EnvLastWins).Execute(context.Background(), nil, &buf, nil))
+	require.Equal(t, "override\n", buf.String())
+
+	buf.Reset()
+	err := build().WithEnvConflictPolicy(pipe.EnvConflictError).Execute(context.Background(), nil, &buf, nil)
+	require.ErrorIs(t, err, pipe.ErrEnvConflict)
+	require.Contains(t, err.Error(), `PIPE_TEST_CRITICAL is both "inherited" and "override"`)
+	require.Empty(t, buf.String())
+}
+
+func TestEnvConflictPolicyShellAssignments(t *testing.T) {
+	err := pipe.Shell("A=1 A=2 true").WithEnvConflictPolicy(pipe.EnvConflictError).Run(context.Background())
+	require.ErrorIs(t, err, pipe.ErrEnvConflict)
+	require.NoError(t, pipe.Shell("A=1 A=1 true").WithEnvConflictPolicy(pipe.EnvConflictError).Run(context.Background()))
+}
+
+func TestWithEnvRewriter(t *testing.T) {
+	var buf bytes.Buffer
+	err := pipe.NewPiped("sh", "-c", "echo $TOKEN $GREETING").WithEnvVar("GREETING", "hi").
+		WithEnvRewriter(func(env []string) []string {
+			return append(env, "TOKEN=fresh")
+		}).Execute(context.Background(), nil, &buf, nil)
+	require.NoError(t, err)
+	require.Equal(t, "fresh hi\n", buf.String())
+}
+
+func TestWithEnvRewriterRemovesEverything(t *testing.T) {
+	t.Setenv("PIPE_TEST_INHERITED", "inherited")
+	var buf bytes.Buffer
+	err := pipe.NewPiped("/bin/sh", "-c", "echo ${PIPE_TEST_INHERITED:-unset}").
+		WithEnvRewriter(func(env []string) []string {
+			var kept []string
+			return kept
+		}).Execute(context.Background(), nil, &buf, nil)
+	require.NoError(t, err)
+	require.Equal(t, "unset\n", buf.String())
+}
+
+func TestWithEnvRewriterIsLastWord(t *testing.T) {
+	var buf bytes.Buffer
+	err := pipe.NewPiped("sh", "-c", "echo ${SECRET:-unset}").WithEnvVar("SECRET", "shh").
+		WithEnvRewriter(func(env []string) []string {
+			var kept []string
+			for _, e := range env {
+				if !strings.HasPrefix(e, "SECRET=") {
+					kept = append(kept, e)
+				}
+			}
+			return kept
+		}).Execute(context.Background(), nil, &buf, nil)
+	require.NoError(t, err)
+	require.Equal(t, "unset\n", buf.String())
+}
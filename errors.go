@@ -0,0 +1,182 @@
+package pipe
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// ExitStatus says which stages decide whether a pipeline failed.
+type ExitStatus int
+
+const (
+	// ExitStatusPipefail fails the pipeline if any stage fails, with the error of the first stage that did, like the
+	// shell's "set -o pipefail".  It is the default.
+	ExitStatusPipefail ExitStatus = iota
+	// ExitStatusLastStage fails the pipeline only if its last stage fails, the way the shell does by default, so a
+	// producer failing or being killed once the consumer has all it needs does not count.  A stage that cannot be
+	// started still fails the pipeline.
+	ExitStatusLastStage
+)
+
+// WithExitStatus sets which stages decide whether the pipeline failed.
+func (p *PipedCmd) WithExitStatus(mode ExitStatus) *PipedCmd {
+	return p.setOption(func(o *options) {
+		o.exitStatus = mode
+	})
+}
+
+// PipelineError is the error of a pipeline that failed because one of its stages did.  It wraps the error that stage
+// ended with.
+type PipelineError struct {
+	// DeterminingStage is the index of the stage the pipeline's failure was taken from under its ExitStatus, with the
+	// head of the pipeline being stage zero, so callers can tell a failing producer from a failing consumer
+	DeterminingStage int
+	Cmd              string
+	// ExitCode is -1 if the stage did not exit normally, for example because it was killed or could not be started
+	ExitCode int
+	Outcome  StageOutcome
+	Err      error
+	// Env is the environment the stage ran with, with WithCaptureEnvOnError.  It is not part of Error.
+	Env []string
+}
+
+func (e *PipelineError) Error() string {
+	return fmt.Sprintf("stage %d %s: %v", e.DeterminingStage, e.Cmd, e.Err)
+}
+
+func (e *PipelineError) Unwrap() error {
+	return e.Err
+}
+
+// UserMessage describes the failure in a short sentence fit to show the user of a command line tool, such as
+// "command 'jq' failed (exit 4)".  Error has the full detail for logs.
+func (e *PipelineError) UserMessage() string {
+	switch {
+	case e.Outcome == StageTimedOut:
+		return fmt.Sprintf("command '%s' timed out", e.Cmd)
+	case e.Outcome == StageKilled:
+		return fmt.Sprintf("command '%s' was killed", e.Cmd)
+	case e.ExitCode >= 0:
+		return fmt.Sprintf("command '%s' failed (exit %d)", e.Cmd, e.ExitCode)
+	default:
+		return fmt.Sprintf("command '%s' could not be run", e.Cmd)
+	}
+}
+
+// WithCaptureEnvOnError sets the Env of a PipelineError to the environment the failing stage ran with, to debug
+// problems like a command not finding its config.  It is off by default since environments often hold secrets.  The
+// values of variables whose names look secret, containing words like TOKEN, SECRET, PASSWORD or KEY, are replaced with
+// REDACTED, but the rest are captured as they are, so take care where the error is logged.
+func (p *PipedCmd) WithCaptureEnvOnError() *PipedCmd {
+	return p.setOption(func(o *options) {
+		o.captureEnv = true
+	})
+}
+
+// secretWords mark variables WithCaptureEnvOnError does not capture the value of.
+var secretWords = []string{
+	"TOKEN", "SECRET", "PASSWORD", "PASSWD", "PASS", "PWD", "KEY", "CREDENTIAL", "AUTH", "SESSION",
+}
+
+// notSecretWords hold a secret word without being secret, and are ignored when looking for one.
+var notSecretWords = []string{"KEYBOARD", "TOKENIZER", "AUTHOR"}
+
+// notSecretNames are variables with a secret word in their name that are known not to be secret.
+var notSecretNames = []string{"PWD", "OLDPWD"}
+
+// redactEnv copies env with the values of variables that look secret replaced.
+func redactEnv(env []string) []string {
+	ret := make([]string, 0, len(env))
+	for _, e := range env {
+		if k, _, found := strings.Cut(e, "="); found && secretName(k) {
+			e = k + "=REDACTED"
+		}
+		ret = append(ret, e)
+	}
+	return ret
+}
+
+// secretName reports if the variable name k contains one of secretWords, so PGPASSWORD is secret but TOKENIZER_PATH
+// is not.
+func secretName(k string) bool {
+	upper := strings.ToUpper(k)
+	for _, name := range notSecretNames {
+		if upper == name {
+			return false
+		}
+	}
+	for _, word := range notSecretWords {
+		upper = strings.ReplaceAll(upper, word, "_")
+	}
+	for _, word := range secretWords {
+		if strings.Contains(upper, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// stageError wraps the error of stage i as a PipelineError.
+func (e *execution) stageError(i int) error {
+	r := e.runs[i]
+	ret := &PipelineError{
+		DeterminingStage: i,
+		Cmd:              r.name,
+		ExitCode:         r.exitCode(),
+		Outcome:          r.outcome,
+		Err:              r.err,
+	}
+	if e.opts.captureEnv {
+		env := r.cmd.Env
+		if env == nil {
+			env = os.Environ()
+		}
+		ret.Env = redactEnv(env)
+	}
+	return ret
+}
+
+// ExitCodeOf maps the error of a pipeline to the exit code a shell would report for it, so every way a stage can fail
+// gives a code callers can pass on:
+//
+//   - 0 for a nil error
+//   - the stage's own code if it exited normally
+//   - 128+N if it was killed by signal N, including by a timeout
+//   - 127 if its program could not be found
+//   - 126 if its program could not be executed for lack of permission
+//   - 1 for any other error
+func ExitCodeOf(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if ws, ok := exitErr.Sys().(interface {
+			Signaled() bool
+			Signal() syscall.Signal
+		}); ok && ws.Signaled() {
+			return 128 + int(ws.Signal())
+		}
+		if code := exitErr.ExitCode(); code >= 0 {
+			return code
+		}
+		return 1
+	}
+	// Programs that cannot be found or executed are reported by os/exec when it looks them up or starts them
+	var execErr *exec.Error
+	var pipeErr *PipelineError
+	if errors.As(err, &execErr) || errors.As(err, &pipeErr) && pipeErr.Outcome == StageFailed && pipeErr.ExitCode < 0 {
+		switch {
+		case errors.Is(err, fs.ErrPermission):
+			return 126
+		case errors.Is(err, exec.ErrNotFound) || errors.Is(err, fs.ErrNotExist):
+			return 127
+		}
+	}
+	return 1
+}
@@ -0,0 +1,124 @@
+package pipe_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cresta/pipe"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPipelineErrorUserMessage(t *testing.T) {
+	err := pipe.NewPiped("echo", "{}").Pipe("sh", "-c", "exit 4").Execute(context.Background(), nil, nil, nil)
+	var pipeErr *pipe.PipelineError
+	require.True(t, errors.As(err, &pipeErr))
+	require.Equal(t, 1, pipeErr.DeterminingStage)
+	require.Equal(t, 4, pipeErr.ExitCode)
+	require.Equal(t, "command 'sh' failed (exit 4)", pipeErr.UserMessage())
+	require.Equal(t, "stage 1 sh: exit status 4", err.Error())
+	var exitErr *exec.ExitError
+	require.True(t, errors.As(err, &exitErr))
+}
+
+func TestPipelineErrorUserMessageTimedOut(t *testing.T) {
+	err := pipe.NewPiped("sleep", "10").WithTimeout(50*time.Millisecond).Execute(context.Background(), nil, nil, nil)
+	var pipeErr *pipe.PipelineError
+	require.True(t, errors.As(err, &pipeErr))
+	require.Equal(t, "command 'sleep' timed out", pipeErr.UserMessage())
+}
+
+func TestPipelineErrorUserMessageNotFound(t *testing.T) {
+	err := pipe.NewPiped("/does/not/exist").Run(context.Background())
+	var pipeErr *pipe.PipelineError
+	require.True(t, errors.As(err, &pipeErr))
+	require.Equal(t, "command '/does/not/exist' could not be run", pipeErr.UserMessage())
+}
+
+func TestDeterminingStagePipefail(t *testing.T) {
+	err := pipe.NewPiped("sh", "-c", "echo hi; exit 3").
+		Pipe("sh", "-c", "cat >/dev/null; exit 5").
+		Execute(context.Background(), nil, nil, nil)
+	var pipeErr *pipe.PipelineError
+	require.True(t, errors.As(err, &pipeErr))
+	require.Equal(t, 0, pipeErr.DeterminingStage)
+	require.Equal(t, 3, pipeErr.ExitCode)
+}
+
+func TestDeterminingStageLastStage(t *testing.T) {
+	err := pipe.NewPiped("sh", "-c", "echo hi; exit 3").
+		Pipe("sh", "-c", "cat >/dev/null; exit 5").
+		WithExitStatus(pipe.ExitStatusLastStage).
+		Execute(context.Background(), nil, nil, nil)
+	var pipeErr *pipe.PipelineError
+	require.True(t, errors.As(err, &pipeErr))
+	require.Equal(t, 1, pipeErr.DeterminingStage)
+	require.Equal(t, 5, pipeErr.ExitCode)
+}
+
+func TestLastStageIgnoresProducerFailure(t *testing.T) {
+	var out bytes.Buffer
+	err := pipe.NewPiped("yes").Pipe("head", "-n", "2").
+		WithExitStatus(pipe.ExitStatusLastStage).
+		Execute(context.Background(), nil, &out, nil)
+	require.NoError(t, err)
+	require.Equal(t, "y\ny\n", out.String())
+
+	err = pipe.NewPiped("true").Pipe("/does/not/exist").
+		WithExitStatus(pipe.ExitStatusLastStage).
+		Execute(context.Background(), nil, nil, nil)
+	require.Error(t, err)
+}
+
+func TestExitCodeOf(t *testing.T) {
+	ctx := context.Background()
+	require.Equal(t, 0, pipe.ExitCodeOf(pipe.NewPiped("true").Run(ctx)))
+	require.Equal(t, 3, pipe.ExitCodeOf(pipe.NewPiped("sh", "-c", "exit 3").Run(ctx)))
+	require.Equal(t, 127, pipe.ExitCodeOf(pipe.NewPiped("command-that-does-not-exist").Run(ctx)))
+	require.Equal(t, 127, pipe.ExitCodeOf(pipe.NewPiped("/does/not/exist").Run(ctx)))
+	require.Equal(t, 1, pipe.ExitCodeOf(errors.New("something else")))
+}
+
+func TestExitCodeOfSignal(t *testing.T) {
+	err := pipe.NewPiped("sh", "-c", "kill -TERM $$").Run(context.Background())
+	require.Equal(t, 128+15, pipe.ExitCodeOf(err))
+}
+
+func TestExitCodeOfNotExecutable(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "script")
+	require.NoError(t, os.WriteFile(script, []byte("#!/bin/sh\n"), 0o600))
+	require.Equal(t, 126, pipe.ExitCodeOf(pipe.NewPiped(script).Run(context.Background())))
+}
+
+func TestCaptureEnvOnError(t *testing.T) {
+	err := pipe.NewPiped("true").Pipe("sh", "-c", "exit 2").WithEnv([]string{"CONFIG=/etc/app.yaml", "API_TOKEN=hunter2"}).
+		WithCaptureEnvOnError().Execute(context.Background(), nil, nil, nil)
+	var pipeErr *pipe.PipelineError
+	require.True(t, errors.As(err, &pipeErr))
+	require.Equal(t, []string{"CONFIG=/etc/app.yaml", "API_TOKEN=REDACTED"}, pipeErr.Env)
+	require.NotContains(t, err.Error(), "CONFIG")
+}
+
+func TestCaptureEnvOnErrorSecretNames(t *testing.T) {
+	err := pipe.NewPiped("sh", "-c", "exit 2").
+		WithEnv([]string{"KEYBOARD_LAYOUT=us", "TOKENIZER_PATH=/opt/tok", "AUTHOR=me", "PWD=/tmp", "PGPASSWORD=a",
+			"APIKEY=b", "GITHUBTOKEN=c", "MYSQL_PWD=d", "aws_secret_access_key=e", "KEYBOARD_API_KEY=f"}).
+		WithCaptureEnvOnError().Execute(context.Background(), nil, nil, nil)
+	var pipeErr *pipe.PipelineError
+	require.True(t, errors.As(err, &pipeErr))
+	require.Equal(t, []string{"KEYBOARD_LAYOUT=us", "TOKENIZER_PATH=/opt/tok", "AUTHOR=me", "PWD=/tmp",
+		"PGPASSWORD=REDACTED", "APIKEY=REDACTED", "GITHUBTOKEN=REDACTED", "MYSQL_PWD=REDACTED",
+		"aws_secret_access_key=REDACTED", "KEYBOARD_API_KEY=REDACTED"}, pipeErr.Env)
+}
+
+func TestCaptureEnvOnErrorOff(t *testing.T) {
+	err := pipe.NewPiped("sh", "-c", "exit 2").WithEnv([]string{"CONFIG=/etc/app.yaml"}).Run(context.Background())
+	var pipeErr *pipe.PipelineError
+	require.True(t, errors.As(err, &pipeErr))
+	require.Nil(t, pipeErr.Env)
+}
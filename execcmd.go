@@ -0,0 +1,84 @@
+package pipe
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+)
+
+// FromExecCmd builds a pipeline from existing exec.Cmd values, piping each into the next, and returns the last stage.
+// It makes it possible to move code built on os/exec to this package gradually.
+//
+// Only the program, arguments, environment and directory are copied.  Everything else, including Stdin, Stdout,
+// Stderr, ExtraFiles and SysProcAttr, is ignored since the pipeline manages it.  The exec.Cmd values are not modified
+// and should not be started themselves.
+func FromExecCmd(cmds ...*exec.Cmd) *PipedCmd {
+	if len(cmds) == 0 {
+		panic("no commands to pipe")
+	}
+	var ret *PipedCmd
+	for _, c := range cmds {
+		name := c.Path
+		if name == "" && len(c.Args) > 0 {
+			name = c.Args[0]
+		}
+		var args []string
+		if len(c.Args) > 1 {
+			args = append(args, c.Args[1:]...)
+		}
+		next := NewPiped(name, args...)
+		if c.Env != nil {
+			next.env = append([]string(nil), c.Env...)
+		}
+		next.dir = c.Dir
+		if ret != nil {
+			next = ret.PipeTo(next)
+		}
+		ret = next
+	}
+	return ret
+}
+
+// BuildCommands makes the exec.Cmd for each stage of the pipeline ending at p, head first, without starting any of
+// them.  It is an escape hatch for code that needs to customize the commands further or that manages processes
+// itself.  Each command's stdout, or stderr for stages piped with PipeStderrTo, is piped into the next command's
+// stdin.  The head's Stdin, the last command's Stdout and every Stderr are left for the caller to set.
+//
+// The caller owns the commands: it must Start every one of them, in order, and then Wait on every one of them.  The
+// pipeline itself is not marked as executed and none of its per-stage timeouts, callbacks, output handling or
+// WithTempDir apply.
+func (p *PipedCmd) BuildCommands(ctx context.Context) ([]*exec.Cmd, error) {
+	opts := p.options()
+	stages := p.stages()
+	cmds := make([]*exec.Cmd, 0, len(stages))
+	for idx, current := range stages {
+		cmd, err := p.stageCommand(ctx, idx, current, opts)
+		if err != nil {
+			return nil, err
+		}
+		if cmd.Err != nil {
+			return nil, fmt.Errorf("stage %d %s: %w", idx, current.cmd, cmd.Err)
+		}
+		cmds = append(cmds, cmd)
+	}
+	// os/exec closes our copies of the pipes: the write end once the upstream starts and the read end once it is
+	// waited on
+	var readers []io.Closer
+	for idx := 1; idx < len(cmds); idx++ {
+		pipe := cmds[idx-1].StdoutPipe
+		if stages[idx-1].pipeStderr {
+			pipe = cmds[idx-1].StderrPipe
+		}
+		r, err := pipe()
+		if err != nil {
+			for _, c := range readers {
+				_ = c.Close()
+			}
+			return nil, fmt.Errorf("unable to pipe stage %d into stage %d: %w", idx-1, idx, err)
+		}
+		readers = append(readers, r)
+		cmds[idx].Stdin = r
+	}
+	return cmds, nil
+}
@@ -0,0 +1,45 @@
+package pipe_test
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/cresta/pipe"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFromExecCmd(t *testing.T) {
+	dir := t.TempDir()
+	pwd := exec.Command("pwd")
+	pwd.Dir = dir
+	upper := exec.Command("tr", "a-z", "A-Z")
+	suffix := exec.Command("sh", "-c", "cat; echo $SUFFIX")
+	suffix.Env = []string{"SUFFIX=done"}
+	var buf bytes.Buffer
+	require.NoError(t, pipe.FromExecCmd(pwd, upper, suffix).Execute(context.Background(), nil, &buf, nil))
+	require.Equal(t, strings.ToUpper(dir)+"\ndone\n", buf.String())
+}
+
+func TestBuildCommands(t *testing.T) {
+	cmds, err := pipe.NewPiped("echo", "hello world").Pipe("tr", "a-z", "A-Z").BuildCommands(context.Background())
+	require.NoError(t, err)
+	require.Len(t, cmds, 2)
+	require.Equal(t, []string{"tr", "a-z", "A-Z"}, cmds[1].Args)
+	var buf bytes.Buffer
+	cmds[1].Stdout = &buf
+	for _, c := range cmds {
+		require.NoError(t, c.Start())
+	}
+	for _, c := range cmds {
+		require.NoError(t, c.Wait())
+	}
+	require.Equal(t, "HELLO WORLD\n", buf.String())
+}
+
+func TestBuildCommandsNotFound(t *testing.T) {
+	_, err := pipe.NewPiped("echo").Pipe("command-that-does-not-exist").BuildCommands(context.Background())
+	require.ErrorIs(t, err, exec.ErrNotFound)
+}
@@ -0,0 +1,579 @@
+package pipe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// errNotStarted is the error of stages that never started because the pipeline ended first.
+var errNotStarted = errors.New("command was never started")
+
+// execution is a pipeline that has been started and not yet waited on.
+type execution struct {
+	runs       []*stageRun
+	exitMu     sync.Mutex
+	ctx        context.Context
+	withCancel context.CancelFunc
+	opts       *options
+	idle       *idleWriter
+	// copied receives the last stage's output, when it is not written straight to stdout
+	copied *copiedOutput
+	// links[i] carries the output of stage i to stage i+1 with WithInterstageBuffering or WithPipeReadTimeout
+	links []*bufferedLink
+	// command is the command of the head of the pipeline
+	command string
+	started time.Time
+	// input is the stdin the pipeline opened for itself, to close once it is done
+	input io.Closer
+	// policy applies the StdoutErrorPolicy, if there is one
+	policy *policyWriter
+	// written counts the output, if anything needs to know how much there was
+	written *countingWriter
+	// pipes are both ends of every OS pipe between stages, to close if the pipeline fails to start
+	pipes []*os.File
+	// outputs are the files the pipeline writes its output to, to flush and close once it is done
+	outputs []outputFile
+	// tempDir is the directory made WithTempDir, to remove once the pipeline is done
+	tempDir string
+	// stdout and stderr are the writers given to the pipeline, before any wrapping
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// stageRun is one stage of an execution.
+type stageRun struct {
+	cmd *exec.Cmd
+	// name is the command as the stage was given it
+	name           string
+	timeout        time.Duration
+	unblockSignals []os.Signal
+	// stderrPiped is set if the stage's stderr, rather than its stdout, goes to the next stage
+	stderrPiped bool
+	cancel      context.CancelFunc
+	timer       *time.Timer
+	timedOut    atomic.Bool
+	started     time.Time
+	// out is the write end of the OS pipe to the next stage, which is closed once the command has its own copy
+	out *os.File
+	// done is closed once the command has exited, or is known never to start, and the fields below are set
+	done    chan struct{}
+	err     error
+	outcome StageOutcome
+	ended   time.Time
+}
+
+func (p *PipedCmd) start(ctx context.Context, stdin io.Reader, stdout io.Writer, stderr io.Writer) (_ *execution, err error) {
+	for current := p; current != nil; current = current.readFrom {
+		if !current.executed.CompareAndSwap(false, true) {
+			return nil, ErrAlreadyExecuted
+		}
+	}
+	cmdCtx, withCancel := context.WithCancel(ctx)
+	opts := p.options()
+	if stdout == nil && opts.stdout != nil {
+		stdout = opts.stdout
+	}
+	e := &execution{
+		ctx:        ctx,
+		withCancel: withCancel,
+		opts:       opts,
+		command:    p.head().cmd,
+		started:    time.Now(),
+		stdout:     stdout,
+		stderr:     stderr,
+	}
+	defer func() {
+		if err != nil {
+			e.observeRun(err)
+		}
+	}()
+	started := false
+	defer func() {
+		// Error returns stop the execution, but a panic from a callback like an env rewriter must not leak the temp dir
+		if !started {
+			e.removeTempDir()
+		}
+	}()
+	if e.opts.flushOnNewline && stdout != nil {
+		stdout = flushOnNewline(stdout)
+	}
+	// Counting goes outside the flusher, which needs to see if stdout can be flushed
+	if e.opts.onMetrics != nil || e.opts.onEmptyOutput != nil {
+		e.written = &countingWriter{w: stdout}
+		stdout = e.written
+	}
+	if e.opts.stdoutErrorPolicy != StdoutErrorDefault && stdout != nil {
+		e.policy = &policyWriter{
+			w:      stdout,
+			policy: e.opts.stdoutErrorPolicy,
+			abort:  withCancel,
+		}
+		stdout = e.policy
+	}
+	if e.opts.discardOnCancel {
+		stdout = discardOnCancel(ctx, stdout)
+		stderr = discardOnCancel(ctx, stderr)
+	}
+	if e.opts.idleTimeout > 0 {
+		e.idle = newIdleWriter(stdout, e.opts.idleTimeout, withCancel)
+		stdout = e.idle
+	}
+	if len(e.opts.teeFiles) > 0 {
+		if stdout, err = e.openOutputs(stdout); err != nil {
+			e.stop()
+			return nil, err
+		}
+	}
+	if e.opts.openStdin != nil {
+		input, err := e.opts.openStdin()
+		if err != nil {
+			e.stop()
+			return nil, err
+		}
+		e.input = input
+		stdin = input
+	}
+	if e.opts.stdinTransform != nil {
+		if stdin == nil {
+			stdin = strings.NewReader("")
+		}
+		stdin = e.opts.stdinTransform(stdin)
+	}
+	if e.opts.maxInputBytes > 0 && stdin != nil {
+		stdin = io.LimitReader(stdin, e.opts.maxInputBytes)
+	}
+	if e.opts.forceTTY {
+		tty, err := newTTYOutput()
+		if err != nil {
+			e.stop()
+			return nil, err
+		}
+		e.copied = tty
+	} else if e.opts.combinedOutput {
+		combined, err := newCombinedOutput()
+		if err != nil {
+			e.stop()
+			return nil, err
+		}
+		e.copied = combined
+	}
+	if e.opts.combinedOutput {
+		stderr = e.copied.write
+	}
+	if e.opts.tempDir {
+		if err := e.makeTempDir(); err != nil {
+			e.stop()
+			return nil, err
+		}
+	}
+	// Setup and start each command
+	stages := p.stages()
+	if err := checkStages(len(stages)); err != nil {
+		e.stop()
+		return nil, err
+	}
+	e.runs = make([]*stageRun, 0, len(stages))
+	for _, current := range stages {
+		r := &stageRun{
+			name:           current.cmd,
+			timeout:        current.timeout,
+			unblockSignals: current.unblockSignals,
+			stderrPiped:    current.pipeStderr && current.pipeTo != nil,
+			done:           make(chan struct{}),
+		}
+		stageCtx := cmdCtx
+		if r.timeout > 0 {
+			stageCtx, r.cancel = context.WithCancel(cmdCtx)
+		}
+		cmd, err := p.stageCommand(stageCtx, len(e.runs), current, e.opts)
+		if err != nil {
+			e.stop()
+			return nil, err
+		}
+		if e.tempDir != "" {
+			e.useTempDir(cmd, current)
+		}
+		cmd.Stderr = stderr
+		r.cmd = cmd
+		e.runs = append(e.runs, r)
+	}
+	for idx, r := range e.runs {
+		if idx == 0 {
+			r.cmd.Stdin = stdin
+		} else if err := e.connect(idx, stages[idx-1].pipeStderr); err != nil {
+			e.stop()
+			return nil, err
+		}
+		if idx == len(e.runs)-1 {
+			r.cmd.Stdout = stdout
+			if e.copied != nil {
+				r.cmd.Stdout = e.copied.write
+			}
+		}
+	}
+	wave := len(e.runs)
+	if e.opts.bufferStages && e.opts.maxConcurrentStages > 0 && e.opts.maxConcurrentStages < wave {
+		wave = e.opts.maxConcurrentStages
+	}
+	if err := e.startStages(0, wave); err != nil {
+		e.recordStats()
+		e.stop()
+		return nil, err
+	}
+	if e.copied != nil {
+		e.copied.copyTo(stdout)
+	}
+	if wave < len(e.runs) {
+		go e.startWaves(wave)
+	}
+	started = true
+	return e, nil
+}
+
+// stageCommand makes the exec.Cmd for current, the stage at index stage of the pipeline ending at p.  Problems that
+// should only fail the stage once it is started are left in the command's Err.
+func (p *PipedCmd) stageCommand(ctx context.Context, stage int, current *PipedCmd, opts *options) (*exec.Cmd, error) {
+	env := current.environ()
+	if opts.envRewriter != nil {
+		if env == nil {
+			env = os.Environ()
+		}
+		env = opts.envRewriter(append([]string(nil), env...))
+		// A nil Env would inherit this process's environment, bringing back what the rewriter removed
+		if env == nil {
+			env = []string{}
+		}
+	}
+	if opts.envConflict == EnvConflictError {
+		if err := envConflict(env); err != nil {
+			return nil, fmt.Errorf("stage %d %s: %w", stage, current.cmd, err)
+		}
+	}
+	args := current.args
+	if opts.braceExpansion {
+		var err error
+		if args, err = expandBraceArgs(args); err != nil {
+			return nil, fmt.Errorf("stage %d %s: %w", stage, current.cmd, err)
+		}
+	}
+	cmd := newCommand(ctx, current.cmd, args, env)
+	if errors.Is(cmd.Err, exec.ErrNotFound) && opts.onNotFound != nil {
+		if err := opts.onNotFound(current.cmd); err != nil {
+			cmd.Err = err
+		} else {
+			cmd = newCommand(ctx, current.cmd, args, env)
+		}
+	}
+	cmd.Env = env
+	// Stages without their own directory run in the directory of the last stage
+	cmd.Dir = current.dir
+	if cmd.Dir == "" {
+		cmd.Dir = p.dir
+	}
+	if opts.resolveShebang {
+		resolveShebang(cmd, current.cmd)
+	}
+	if cmd.Err == nil {
+		cmd.Err = checkArgList(stage, cmd)
+	}
+	return cmd, nil
+}
+
+// newPipe makes the OS pipes between stages.  It is a variable so tests can make it fail.
+var newPipe = os.Pipe
+
+// newCommand makes the exec.Cmd for a stage, looking the program up in the stage's own PATH.
+func newCommand(ctx context.Context, name string, args []string, env []string) *exec.Cmd {
+	resolved, err := resolveCommand(name, env)
+	//nolint:gosec
+	cmd := exec.CommandContext(ctx, resolved, args...)
+	if err != nil {
+		cmd.Err = err
+	}
+	return cmd
+}
+
+// connect pipes the output of the command before idx into the command at idx.
+func (e *execution) connect(idx int, fromStderr bool) error {
+	upstream, downstream := e.runs[idx-1].cmd, e.runs[idx].cmd
+	if fromStderr {
+		// The upstream's stdout is thrown away, like 2>&1 >/dev/null
+		upstream.Stderr = nil
+	}
+	if e.opts.bufferStages || e.opts.pipeReadTimeout > 0 {
+		l, err := newBufferedLink(!e.opts.bufferStages)
+		if err != nil {
+			return err
+		}
+		if e.links == nil {
+			e.links = make([]*bufferedLink, len(e.runs)-1)
+		}
+		e.links[idx-1] = l
+		if fromStderr {
+			upstream.Stderr = l
+		} else {
+			upstream.Stdout = l
+		}
+		downstream.Stdin = l.stdin
+		return nil
+	}
+	r, w, err := newPipe()
+	if err != nil {
+		return fmt.Errorf("unable to create pipe: %w", err)
+	}
+	e.pipes = append(e.pipes, r, w)
+	if fromStderr {
+		upstream.Stderr = w
+	} else {
+		upstream.Stdout = w
+	}
+	e.runs[idx-1].out = w
+	downstream.Stdin = r
+	return nil
+}
+
+// startStages starts the commands from index from up to to.  If one fails to start, every command started so far is
+// waited on, the rest are marked as never started, and the start error is returned.
+func (e *execution) startStages(from int, to int) error {
+	for idx := from; idx < to; idx++ {
+		r := e.runs[idx]
+		err := startUnblocked(r.cmd, r.unblockSignals)
+		if idx > 0 {
+			e.closeStdin(idx)
+		}
+		if r.out != nil {
+			_ = r.out.Close()
+		}
+		if err != nil {
+			e.withCancel()
+			// Wait for the previous commands to finish so we do not leak
+			for i := from; i < idx; i++ {
+				e.finish(i, e.runs[i].cmd.Wait(), true)
+			}
+			e.finish(idx, fmt.Errorf("unable to start command: %w", err), false)
+			e.notStarted(idx + 1)
+			for i := 0; i < from; i++ {
+				<-e.runs[i].done
+			}
+			return e.stageError(idx)
+		}
+		r.started = time.Now()
+		if e.links != nil && idx > 0 && e.opts.pipeReadTimeout > 0 {
+			e.links[idx-1].arm(e.opts.pipeReadTimeout, e.withCancel)
+		}
+		if r.timeout > 0 {
+			r.timer = time.AfterFunc(r.timeout, func() {
+				r.timedOut.Store(true)
+				r.cancel()
+			})
+		}
+	}
+	for idx := from; idx < to; idx++ {
+		go e.reap(idx)
+	}
+	return nil
+}
+
+// startWaves starts the commands from index from onward in waves, each started once the wave before it has exited,
+// so no more than from run at a time.
+func (e *execution) startWaves(from int) {
+	wave := from
+	for ; from < len(e.runs); from += wave {
+		for i := from - wave; i < from; i++ {
+			<-e.runs[i].done
+		}
+		if e.ctx.Err() != nil {
+			e.notStarted(from)
+			return
+		}
+		to := from + wave
+		if to > len(e.runs) {
+			to = len(e.runs)
+		}
+		if err := e.startStages(from, to); err != nil {
+			return
+		}
+	}
+}
+
+// notStarted marks every command from index from onward as never started.
+func (e *execution) notStarted(from int) {
+	for idx := from; idx < len(e.runs); idx++ {
+		if idx > 0 {
+			e.closeStdin(idx)
+		}
+		e.finish(idx, errNotStarted, false)
+	}
+}
+
+// closeStdin closes this process's copy of the read end of the pipe into the command at idx, once the command has
+// started with its own copy or will never start.  Holding on to it would keep the upstream from seeing a broken pipe
+// when the command exits early, like head does, and so stop it ever exiting.
+func (e *execution) closeStdin(idx int) {
+	if e.links != nil {
+		_ = e.links[idx-1].stdin.Close()
+		return
+	}
+	if c, ok := e.runs[idx].cmd.Stdin.(io.Closer); ok {
+		_ = c.Close()
+	}
+}
+
+// reap waits for a command in the background, so stages are seen to exit in the order they really do.
+func (e *execution) reap(stage int) {
+	e.finish(stage, e.runs[stage].cmd.Wait(), true)
+}
+
+// finish records the end of a command.  Started commands have the exit callback run for them, one call at a time.
+func (e *execution) finish(stage int, err error, started bool) {
+	r := e.runs[stage]
+	r.ended = time.Now()
+	if r.timer != nil {
+		r.timer.Stop()
+	}
+	if r.cancel != nil {
+		r.cancel()
+	}
+	if e.links != nil && stage < len(e.links) {
+		e.links[stage].closeWrite()
+	}
+	if started && r.cmd.ProcessState != nil && r.cmd.ProcessState.Success() &&
+		(errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)) {
+		// os/exec reports the context's error for a command that exits cleanly just as it is cancelled, but it did
+		// succeed
+		err = nil
+	}
+	r.outcome = r.outcomeOf(err, started)
+	if r.outcome == StageTimedOut {
+		err = fmt.Errorf("timed out after %s: %w", r.timeout, err)
+	}
+	r.err = err
+	if started && (e.opts.onStageExit != nil || e.opts.onStageState != nil) {
+		e.exitMu.Lock()
+		if e.opts.onStageExit != nil {
+			e.opts.onStageExit(stage, r.exitCode(), err)
+		}
+		if e.opts.onStageState != nil && r.cmd.ProcessState != nil {
+			e.opts.onStageState(stage, r.cmd.ProcessState)
+		}
+		e.exitMu.Unlock()
+	}
+	close(r.done)
+}
+
+func (r *stageRun) outcomeOf(err error, started bool) StageOutcome {
+	switch {
+	case errors.Is(err, errNotStarted):
+		return StageNotStarted
+	case err == nil:
+		return StageSuccess
+	case started && r.cmd.ProcessState != nil && !r.cmd.ProcessState.Exited():
+		if r.timedOut.Load() {
+			return StageTimedOut
+		}
+		return StageKilled
+	default:
+		return StageFailed
+	}
+}
+
+// exitCode is the code the stage exited with, or -1 if it did not exit normally.
+func (r *stageRun) exitCode() int {
+	if r.cmd.ProcessState == nil {
+		return -1
+	}
+	return r.cmd.ProcessState.ExitCode()
+}
+
+func (e *execution) wait() (err error) {
+	defer e.stop()
+	defer func() {
+		e.observeRun(err)
+	}()
+	var waitErr error
+	cancelled := false
+	// Look at the last in the chain first, so a failure early in the pipeline does not cut short later commands still
+	// working through what it wrote
+	for i := len(e.runs) - 1; i >= 0; i-- {
+		<-e.runs[i].done
+		if e.runs[i].err != nil && e.decides(i) {
+			// We will end up returning the *last* wait error, which will be the first command of the pipes that failed.
+			// Commands we killed ourselves because a later one failed are not to blame, though.
+			if !cancelled || e.runs[i].outcome != StageKilled {
+				waitErr = e.stageError(i)
+			}
+			cancelled = true
+			e.withCancel()
+		}
+	}
+	for _, l := range e.links {
+		<-l.pumped
+	}
+	if e.copied != nil {
+		if err := e.copied.wait(); err != nil && waitErr == nil {
+			waitErr = fmt.Errorf("unable to copy output: %w", err)
+		}
+	}
+	if err := e.flush(); err != nil && waitErr == nil {
+		waitErr = err
+	}
+	if err := e.closeOutputs(); err != nil && waitErr == nil {
+		waitErr = err
+	}
+	e.recordStats()
+	e.warnEmptyOutput()
+	if e.stop() {
+		return fmt.Errorf("no output for %s: %w", e.opts.idleTimeout, ErrIdleTimeout)
+	}
+	if e.policy != nil && e.policy.policy == StdoutErrorAbort {
+		if err := e.policy.failed(); err != nil {
+			return fmt.Errorf("unable to write output: %w", err)
+		}
+	}
+	for i, l := range e.links {
+		if l.idled() {
+			return fmt.Errorf("no data between stage %d and %d for %s: %w", i, i+1, e.opts.pipeReadTimeout, ErrPipeReadTimeout)
+		}
+	}
+	return waitErr
+}
+
+// decides reports if stage i failing fails the pipeline.
+func (e *execution) decides(i int) bool {
+	if e.opts.exitStatus != ExitStatusLastStage || i == len(e.runs)-1 {
+		return true
+	}
+	r := e.runs[i]
+	return r.started.IsZero() && r.outcome == StageFailed
+}
+
+// stop releases the execution's resources and reports if the idle timeout fired.
+func (e *execution) stop() bool {
+	e.withCancel()
+	for _, l := range e.links {
+		if l != nil {
+			l.closeWrite()
+			_ = l.stdin.Close()
+		}
+	}
+	if e.copied != nil && e.copied.done == nil {
+		_ = e.copied.wait()
+	}
+	if e.input != nil {
+		_ = e.input.Close()
+	}
+	for _, f := range e.pipes {
+		_ = f.Close()
+	}
+	_ = e.closeOutputs()
+	e.removeTempDir()
+	return e.idle != nil && e.idle.stop()
+}
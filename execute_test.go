@@ -0,0 +1,57 @@
+package pipe_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/cresta/pipe"
+	"github.com/stretchr/testify/require"
+)
+
+func openFDs(t *testing.T) int {
+	t.Helper()
+	fds, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		t.Skip("cannot list open files")
+	}
+	return len(fds)
+}
+
+// failNthPipe makes the nth pipe between stages fail to be created.
+func failNthPipe(t *testing.T, n int) {
+	calls := 0
+	restore := pipe.SetNewPipe(func() (*os.File, *os.File, error) {
+		calls++
+		if calls == n {
+			return nil, nil, errors.New("injected pipe failure")
+		}
+		return os.Pipe()
+	})
+	t.Cleanup(restore)
+}
+
+func TestPipeSetupFailureLeaksNoFiles(t *testing.T) {
+	require.NoError(t, pipe.NewPiped("echo", "warm up").Pipe("cat").Execute(context.Background(), nil, nil, nil))
+	before := openFDs(t)
+	failNthPipe(t, 3)
+	err := pipe.NewPiped("echo", "hi").Pipe("cat").Pipe("cat").Pipe("cat").
+		Execute(context.Background(), nil, nil, nil)
+	require.ErrorContains(t, err, "injected pipe failure")
+	require.Equal(t, before, openFDs(t))
+}
+
+func TestBufferedSetupFailureLeaksNoFiles(t *testing.T) {
+	require.NoError(t, pipe.NewPiped("echo", "warm up").Pipe("cat").Execute(context.Background(), nil, nil, nil))
+	before := openFDs(t)
+	failNthPipe(t, 2)
+	err := pipe.NewPiped("echo", "hi").Pipe("cat").Pipe("cat").
+		WithInterstageBuffering().
+		Execute(context.Background(), nil, nil, nil)
+	require.ErrorContains(t, err, "injected pipe failure")
+	require.Eventually(t, func() bool {
+		return openFDs(t) == before
+	}, time.Second, 10*time.Millisecond)
+}
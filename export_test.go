@@ -0,0 +1,24 @@
+package pipe
+
+import (
+	"io"
+	"os"
+)
+
+// SetNewPipe has pipes between stages made by f until the returned func is called.
+func SetNewPipe(f func() (*os.File, *os.File, error)) (restore func()) {
+	old := newPipe
+	newPipe = f
+	return func() {
+		newPipe = old
+	}
+}
+
+// SetOpenOutputFile has output files opened by f until the returned func is called.
+func SetOpenOutputFile(f func(path string) (io.WriteCloser, error)) (restore func()) {
+	old := openOutputFile
+	openOutputFile = f
+	return func() {
+		openOutputFile = old
+	}
+}
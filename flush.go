@@ -0,0 +1,192 @@
+package pipe
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+)
+
+// WithDiscardOnCancel drops any output that arrives after the pipeline's context is cancelled, and skips flushing the
+// output writers.  By default a cancelled pipeline still delivers everything its commands wrote before they were
+// killed, and writers with a Flush method, like *bufio.Writer or http.ResponseWriter, are flushed as the pipeline
+// finishes whether or not it was cancelled.  Keeping that partial output is what you want when capturing logs, to see
+// how far a pipeline got.
+func (p *PipedCmd) WithDiscardOnCancel() *PipedCmd {
+	return p.setOption(func(o *options) {
+		o.discardOnCancel = true
+	})
+}
+
+// WithFlushOnNewline flushes stdout each time a stage writes a line to it, if stdout has a Flush method as
+// http.ResponseWriter and *bufio.Writer do.  It is for streaming a command's output to an HTTP client, or anything
+// else that buffers, as the command produces it instead of once the buffer fills.
+func (p *PipedCmd) WithFlushOnNewline() *PipedCmd {
+	return p.setOption(func(o *options) {
+		o.flushOnNewline = true
+	})
+}
+
+type flusher interface {
+	Flush() error
+}
+
+// plainFlusher is a flusher that cannot fail, like http.Flusher.
+type plainFlusher interface {
+	Flush()
+}
+
+// flushFunc returns a func that flushes w, or nil if w cannot be flushed.
+func flushFunc(w io.Writer) func() error {
+	switch f := w.(type) {
+	case flusher:
+		return f.Flush
+	case plainFlusher:
+		return func() error {
+			f.Flush()
+			return nil
+		}
+	}
+	return nil
+}
+
+// flush flushes the pipeline's writers as it finishes, unless partial output is to be discarded.
+func (e *execution) flush() error {
+	if e.opts.discardOnCancel && e.ctx.Err() != nil {
+		return nil
+	}
+	for _, w := range []io.Writer{e.stdout, e.stderr} {
+		if f := flushFunc(w); f != nil {
+			if err := f(); err != nil {
+				return fmt.Errorf("unable to flush output: %w", err)
+			}
+		}
+		if sameWriter(e.stderr, e.stdout) {
+			break
+		}
+	}
+	return nil
+}
+
+// sameWriter reports if a and b are the same pointer.  Writers of other kinds are never the same, since comparing two
+// values of an uncomparable type, like a func or a slice, panics.
+func sameWriter(a, b io.Writer) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	ta, tb := reflect.TypeOf(a), reflect.TypeOf(b)
+	return ta == tb && ta.Kind() == reflect.Pointer && a == b
+}
+
+// discardOnCancel wraps w to drop writes once ctx is done.
+func discardOnCancel(ctx context.Context, w io.Writer) io.Writer {
+	if w == nil {
+		return nil
+	}
+	return &cancelWriter{
+		ctx: ctx,
+		w:   w,
+	}
+}
+
+type cancelWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func (c *cancelWriter) Write(p []byte) (int, error) {
+	if c.ctx.Err() != nil {
+		return len(p), nil
+	}
+	return c.w.Write(p)
+}
+
+// flushOnNewline wraps w to flush it after every write that ends a line, if it can be flushed.
+func flushOnNewline(w io.Writer) io.Writer {
+	f := flushFunc(w)
+	if f == nil {
+		return w
+	}
+	return &newlineFlusher{
+		w:     w,
+		flush: f,
+	}
+}
+
+type newlineFlusher struct {
+	w     io.Writer
+	flush func() error
+}
+
+func (n *newlineFlusher) Write(p []byte) (int, error) {
+	written, err := n.w.Write(p)
+	if err != nil || bytes.IndexByte(p[:written], '\n') < 0 {
+		return written, err
+	}
+	if err := n.flush(); err != nil {
+		return written, fmt.Errorf("unable to flush output: %w", err)
+	}
+	return written, nil
+}
+
+// StdoutErrorPolicy says what a pipeline does when writing to its stdout fails.
+type StdoutErrorPolicy int
+
+const (
+	// StdoutErrorDefault leaves it to os/exec: the last stage sees a broken pipe, and the rest carry on until they
+	// notice.
+	StdoutErrorDefault StdoutErrorPolicy = iota
+	// StdoutErrorAbort kills the whole pipeline at once and fails it with the write error, to stop wasting work on
+	// output nobody will see, such as a streaming HTTP response to a client that has gone away.
+	StdoutErrorAbort
+	// StdoutErrorDiscard drops the rest of the output and lets the pipeline run to the end as if nothing happened,
+	// for best-effort sinks such as logs.
+	StdoutErrorDiscard
+)
+
+// WithStdoutErrorPolicy sets what the pipeline does when writing to its stdout fails.
+func (p *PipedCmd) WithStdoutErrorPolicy(policy StdoutErrorPolicy) *PipedCmd {
+	return p.setOption(func(o *options) {
+		o.stdoutErrorPolicy = policy
+	})
+}
+
+// policyWriter applies a StdoutErrorPolicy to the writes to w.
+type policyWriter struct {
+	w      io.Writer
+	policy StdoutErrorPolicy
+	abort  func()
+
+	mu  sync.Mutex
+	err error
+}
+
+func (p *policyWriter) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		if p.policy == StdoutErrorDiscard {
+			return len(b), nil
+		}
+		return 0, p.err
+	}
+	n, err := p.w.Write(b)
+	if err == nil {
+		return n, nil
+	}
+	p.err = err
+	if p.policy == StdoutErrorDiscard {
+		return len(b), nil
+	}
+	p.abort()
+	return n, err
+}
+
+// failed returns the error writing failed with, if it did.
+func (p *policyWriter) failed() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
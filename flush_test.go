@@ -0,0 +1,146 @@
+package pipe_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cresta/pipe"
+	"github.com/stretchr/testify/require"
+)
+
+// cancellingWriter buffers like a bufio.Writer and cancels a context as soon as anything is written to it.
+type cancellingWriter struct {
+	w      *bufio.Writer
+	cancel context.CancelFunc
+}
+
+func (c *cancellingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.cancel()
+	return n, err
+}
+
+func (c *cancellingWriter) Flush() error {
+	return c.w.Flush()
+}
+
+func TestCancelFlushesPartialOutput(t *testing.T) {
+	var buf bytes.Buffer
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	out := &cancellingWriter{w: bufio.NewWriter(&buf), cancel: cancel}
+	err := pipe.NewPiped("sh", "-c", "echo a; exec sleep 10").Execute(ctx, nil, out, nil)
+	require.Error(t, err)
+	require.Equal(t, "a\n", buf.String())
+}
+
+func TestDiscardOnCancel(t *testing.T) {
+	var buf bytes.Buffer
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	out := &cancellingWriter{w: bufio.NewWriter(&buf), cancel: cancel}
+	err := pipe.NewPiped("sh", "-c", "echo a; exec sleep 10").WithDiscardOnCancel().Execute(ctx, nil, out, nil)
+	require.Error(t, err)
+	require.Equal(t, "", buf.String())
+}
+
+// countingFlusher is an http.Flusher that records what had been written at each flush.
+type countingFlusher struct {
+	buf     bytes.Buffer
+	flushed []string
+}
+
+func (c *countingFlusher) Write(p []byte) (int, error) {
+	return c.buf.Write(p)
+}
+
+func (c *countingFlusher) Flush() {
+	c.flushed = append(c.flushed, c.buf.String())
+}
+
+func TestFlushOnNewline(t *testing.T) {
+	var w countingFlusher
+	err := pipe.NewPiped("sh", "-c", "echo a; sleep 0.1; echo b; sleep 0.1; printf c").
+		WithFlushOnNewline().
+		Execute(context.Background(), nil, &w, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a\n", "a\nb\n", "a\nb\nc"}, w.flushed)
+}
+
+func TestFlushOnNewlineOff(t *testing.T) {
+	var w countingFlusher
+	err := pipe.NewPiped("sh", "-c", "echo a; sleep 0.1; echo b").Execute(context.Background(), nil, &w, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a\nb\n"}, w.flushed)
+}
+
+var errSinkClosed = errors.New("sink closed")
+
+// failingWriter accepts n bytes and then fails every write.
+type failingWriter struct {
+	n   int
+	buf bytes.Buffer
+}
+
+func (f *failingWriter) Write(p []byte) (int, error) {
+	room := f.n - f.buf.Len()
+	if room <= 0 {
+		return 0, errSinkClosed
+	}
+	if len(p) > room {
+		f.buf.Write(p[:room])
+		return room, errSinkClosed
+	}
+	return f.buf.Write(p)
+}
+
+func TestStdoutErrorAbort(t *testing.T) {
+	w := &failingWriter{n: 2}
+	start := time.Now()
+	err := pipe.NewPiped("sh", "-c", "echo hello; exec sleep 10").
+		Pipe("cat").
+		WithStdoutErrorPolicy(pipe.StdoutErrorAbort).
+		Execute(context.Background(), nil, w, nil)
+	require.ErrorIs(t, err, errSinkClosed)
+	require.Less(t, time.Since(start), 5*time.Second)
+	require.Equal(t, "he", w.buf.String())
+}
+
+func TestStdoutErrorDiscard(t *testing.T) {
+	w := &failingWriter{n: 10}
+	var stats pipe.PipelineStats
+	err := pipe.NewPiped("seq", "1", "100000").
+		Pipe("cat").
+		WithStdoutErrorPolicy(pipe.StdoutErrorDiscard).
+		WithStats(&stats).
+		Execute(context.Background(), nil, w, nil)
+	require.NoError(t, err)
+	require.Equal(t, "1\n2\n3\n4\n5\n", w.buf.String())
+	require.Equal(t, pipe.StageSuccess, stats.Stages[0].Outcome)
+	require.Equal(t, pipe.StageSuccess, stats.Stages[1].Outcome)
+}
+
+// writerFunc is a writer of an uncomparable type.
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+func TestUncomparableWriters(t *testing.T) {
+	var buf bytes.Buffer
+	var mu sync.Mutex
+	w := writerFunc(func(p []byte) (int, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return buf.Write(p)
+	})
+	require.NoError(t, pipe.NewPiped("sh", "-c", "echo out; echo err >&2").Execute(context.Background(), nil, w, w))
+	require.Contains(t, buf.String(), "out\n")
+	require.Contains(t, buf.String(), "err\n")
+}
@@ -0,0 +1,94 @@
+package pipe
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// ErrIdleTimeout is returned, wrapped, when a pipeline is killed by WithIdleTimeout.
+var ErrIdleTimeout = errors.New("pipeline output went idle")
+
+// ErrPipeReadTimeout is returned, wrapped, when a pipeline is killed by WithPipeReadTimeout.
+var ErrPipeReadTimeout = errors.New("no data passed between stages")
+
+// WithIdleTimeout kills the pipeline if, once it has started writing to stdout, it goes d without writing anything
+// more.  Unlike a context deadline this does not penalize commands that are slow to produce their first byte but then
+// stream steadily, and it catches streams that hang partway through, like a stalled download.
+func (p *PipedCmd) WithIdleTimeout(d time.Duration) *PipedCmd {
+	return p.setOption(func(o *options) {
+		o.idleTimeout = d
+	})
+}
+
+// WithPipeReadTimeout kills the pipeline if no data passes from one stage to the next for d, and fails it with an error
+// naming the two stages, such as "no data between stage 1 and 2 for 30s", to pinpoint where a hung pipeline stalled.
+// The clock for each pair starts once both have started, and stops once the upstream has exited and everything it
+// wrote has been read, so it also catches a stage that never writes at all.
+//
+// To watch the data the stages are connected through this process rather than directly with OS pipes, which costs a
+// copy of everything passed between them.
+func (p *PipedCmd) WithPipeReadTimeout(d time.Duration) *PipedCmd {
+	return p.setOption(func(o *options) {
+		o.pipeReadTimeout = d
+	})
+}
+
+// idleWriter calls onIdle if more than timeout passes between writes.  The clock starts on the first write.
+type idleWriter struct {
+	w       io.Writer
+	timeout time.Duration
+	onIdle  func()
+
+	mu      sync.Mutex
+	timer   *time.Timer
+	stopped bool
+	fired   bool
+}
+
+func newIdleWriter(w io.Writer, timeout time.Duration, onIdle func()) *idleWriter {
+	return &idleWriter{
+		w:       w,
+		timeout: timeout,
+		onIdle:  onIdle,
+	}
+}
+
+func (i *idleWriter) Write(p []byte) (int, error) {
+	i.mu.Lock()
+	switch {
+	case i.stopped:
+	case i.timer == nil:
+		i.timer = time.AfterFunc(i.timeout, i.fire)
+	default:
+		i.timer.Reset(i.timeout)
+	}
+	i.mu.Unlock()
+	if i.w == nil {
+		return len(p), nil
+	}
+	return i.w.Write(p)
+}
+
+func (i *idleWriter) fire() {
+	i.mu.Lock()
+	if i.stopped {
+		i.mu.Unlock()
+		return
+	}
+	i.fired = true
+	i.mu.Unlock()
+	i.onIdle()
+}
+
+// stop disarms the timer and reports if it had already fired.
+func (i *idleWriter) stop() bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.stopped = true
+	if i.timer != nil {
+		i.timer.Stop()
+	}
+	return i.fired
+}
@@ -0,0 +1,52 @@
+package pipe_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cresta/pipe"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdleTimeoutKillsStalledPipeline(t *testing.T) {
+	var buf bytes.Buffer
+	start := time.Now()
+	err := pipe.NewPiped("sh", "-c", "echo a; exec sleep 10").WithIdleTimeout(100*time.Millisecond).Execute(context.Background(), nil, &buf, nil)
+	require.ErrorIs(t, err, pipe.ErrIdleTimeout)
+	require.Less(t, time.Since(start), 5*time.Second)
+	require.Equal(t, "a\n", buf.String())
+}
+
+func TestIdleTimeoutAllowsSlowStart(t *testing.T) {
+	var buf bytes.Buffer
+	err := pipe.NewPiped("sh", "-c", "sleep 0.3; echo a; echo b").WithIdleTimeout(100*time.Millisecond).Execute(context.Background(), nil, &buf, nil)
+	require.NoError(t, err)
+	require.Equal(t, "a\nb\n", buf.String())
+}
+
+func TestPipeReadTimeoutNamesStalledLink(t *testing.T) {
+	var buf bytes.Buffer
+	start := time.Now()
+	err := pipe.NewPiped("echo", "hi").
+		Pipe("sh", "-c", "exec sleep 10").
+		Pipe("cat").
+		WithPipeReadTimeout(200*time.Millisecond).
+		Execute(context.Background(), nil, &buf, nil)
+	require.ErrorIs(t, err, pipe.ErrPipeReadTimeout)
+	require.Contains(t, err.Error(), "no data between stage 1 and 2 for 200ms")
+	require.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestPipeReadTimeoutAllowsSteadyFlow(t *testing.T) {
+	var buf bytes.Buffer
+	err := pipe.NewPiped("sh", "-c", "for i in 1 2 3 4 5; do echo $i; sleep 0.1; done").
+		Pipe("cat").
+		Pipe("wc", "-l").
+		WithPipeReadTimeout(time.Second).
+		Execute(context.Background(), nil, &buf, nil)
+	require.NoError(t, err)
+	require.Equal(t, "5", strings.TrimSpace(buf.String()))
+}
@@ -0,0 +1,84 @@
+package pipe
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"log"
+	"os"
+	"unicode/utf8"
+)
+
+// Logger receives messages about pipelines that have nowhere else to report, such as failures of RunDetached.
+// *log.Logger satisfies it.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// WithLogger sets where the pipeline logs.  The default is the standard library's log package.
+func (p *PipedCmd) WithLogger(l Logger) *PipedCmd {
+	return p.setOption(func(o *options) {
+		o.logger = l
+	})
+}
+
+func (o *options) log() Logger {
+	if o.logger == nil {
+		return log.Default()
+	}
+	return o.logger
+}
+
+// BinaryLogEncoding says how output that is not text is written to the logger, so binary output does not corrupt the
+// logs it is written to.
+type BinaryLogEncoding int
+
+const (
+	// BinaryLogBase64 logs binary output base64 encoded, prefixed with "base64:".  It is the default.
+	BinaryLogBase64 BinaryLogEncoding = iota
+	// BinaryLogHexDump logs binary output as a hex dump, like hexdump -C.
+	BinaryLogHexDump
+)
+
+// WithBinaryLogEncoding sets how output that is not valid UTF-8 text is logged by RunLog.  The output returned is
+// always the raw bytes, and text is always logged as it is.
+func (p *PipedCmd) WithBinaryLogEncoding(enc BinaryLogEncoding) *PipedCmd {
+	return p.setOption(func(o *options) {
+		o.binaryLogEncoding = enc
+	})
+}
+
+// RunLog runs the pipeline, logs its stdout to the logger set with WithLogger, and returns it.  Its stderr goes to
+// this process's stderr.
+func (p *PipedCmd) RunLog(ctx context.Context) ([]byte, error) {
+	var buf bytes.Buffer
+	err := p.Execute(ctx, nil, &buf, os.Stderr)
+	opts := p.options()
+	opts.log().Printf("pipeline %s output: %s", p.describe(), opts.logOutput(buf.Bytes()))
+	return buf.Bytes(), err
+}
+
+// logOutput is b as it should be logged, encoded if it is binary.
+func (o *options) logOutput(b []byte) string {
+	if isText(b) {
+		return string(b)
+	}
+	if o.binaryLogEncoding == BinaryLogHexDump {
+		return "\n" + hex.Dump(b)
+	}
+	return "base64:" + base64.StdEncoding.EncodeToString(b)
+}
+
+// isText reports if b is valid UTF-8 without control characters other than whitespace.
+func isText(b []byte) bool {
+	if !utf8.Valid(b) {
+		return false
+	}
+	for _, c := range b {
+		if c < 0x20 && c != '\t' && c != '\n' && c != '\r' || c == 0x7f {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,45 @@
+package pipe_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/cresta/pipe"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingLogger struct {
+	lines []string
+}
+
+func (l *recordingLogger) Printf(format string, v ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+func TestRunLogText(t *testing.T) {
+	var l recordingLogger
+	out, err := pipe.NewPiped("echo", "hello").WithLogger(&l).RunLog(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "hello\n", string(out))
+	require.Equal(t, []string{"pipeline echo output: hello\n"}, l.lines)
+}
+
+func TestRunLogBinary(t *testing.T) {
+	var l recordingLogger
+	out, err := pipe.NewPiped("printf", `\000\377ab`).WithLogger(&l).RunLog(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []byte{0, 0xff, 'a', 'b'}, out)
+	require.Equal(t, []string{"pipeline printf output: base64:AP9hYg=="}, l.lines)
+}
+
+func TestRunLogBinaryHexDump(t *testing.T) {
+	var l recordingLogger
+	_, err := pipe.NewPiped("printf", `\000\377ab`).WithLogger(&l).WithBinaryLogEncoding(pipe.BinaryLogHexDump).
+		RunLog(context.Background())
+	require.NoError(t, err)
+	require.Len(t, l.lines, 1)
+	require.True(t, strings.Contains(l.lines[0], "00 ff 61 62"), l.lines[0])
+	require.NotContains(t, l.lines[0], "\x00")
+}
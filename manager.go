@@ -0,0 +1,106 @@
+package pipe
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+)
+
+// ErrManagerShutdown is returned when a pipeline is run through a Manager that has been shut down.
+var ErrManagerShutdown = errors.New("pipeline manager has been shut down")
+
+// Manager keeps track of the pipelines run through it so they can all be stopped at once, for example when a server
+// shuts down.  The zero value is ready to use.
+type Manager struct {
+	mu       sync.Mutex
+	cancels  map[int]context.CancelFunc
+	next     int
+	shutdown bool
+	running  sync.WaitGroup
+}
+
+// Run is like p.Run, but the pipeline is killed if the manager shuts down.
+func (m *Manager) Run(ctx context.Context, p *PipedCmd) error {
+	ctx, release, err := m.track(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return p.Run(ctx)
+}
+
+// Execute is like p.Execute, but the pipeline is killed if the manager shuts down.
+func (m *Manager) Execute(ctx context.Context, p *PipedCmd, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+	ctx, release, err := m.track(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return p.Execute(ctx, stdin, stdout, stderr)
+}
+
+// Start is like p.Start, but the pipeline is killed if the manager shuts down.
+func (m *Manager) Start(ctx context.Context, p *PipedCmd) (*Running, error) {
+	ctx, release, err := m.track(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r, err := p.Start(ctx)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	go func() {
+		<-r.done
+		release()
+	}()
+	return r, nil
+}
+
+// Shutdown kills every pipeline running through the manager and waits for them to exit, or for ctx to be done, in
+// which case it returns ctx's error.  Once Shutdown has been called, the manager refuses to run anything more.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.mu.Lock()
+	m.shutdown = true
+	for _, cancel := range m.cancels {
+		cancel()
+	}
+	m.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		m.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// track registers a pipeline about to run, returning the context it should run with and a func to call once it has
+// finished.
+func (m *Manager) track(ctx context.Context) (context.Context, func(), error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.shutdown {
+		return nil, nil, ErrManagerShutdown
+	}
+	if m.cancels == nil {
+		m.cancels = make(map[int]context.CancelFunc)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	id := m.next
+	m.next++
+	m.cancels[id] = cancel
+	m.running.Add(1)
+	return ctx, func() {
+		m.mu.Lock()
+		delete(m.cancels, id)
+		m.mu.Unlock()
+		cancel()
+		m.running.Done()
+	}, nil
+}
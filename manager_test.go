@@ -0,0 +1,40 @@
+package pipe_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cresta/pipe"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManagerShutdown(t *testing.T) {
+	var m pipe.Manager
+	errs := make(chan error, 2)
+	go func() {
+		errs <- m.Execute(context.Background(), pipe.NewPiped("sleep", "10"), nil, nil, nil)
+	}()
+	r, err := m.Start(context.Background(), pipe.NewPiped("sleep", "10").Pipe("cat"))
+	require.NoError(t, err)
+	go func() {
+		errs <- r.Wait()
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, m.Shutdown(ctx))
+	require.Less(t, time.Since(start), 5*time.Second)
+	require.Error(t, <-errs)
+	require.Error(t, <-errs)
+
+	require.ErrorIs(t, m.Run(context.Background(), pipe.NewPiped("true")), pipe.ErrManagerShutdown)
+}
+
+func TestManagerRunsToCompletion(t *testing.T) {
+	var m pipe.Manager
+	require.NoError(t, m.Execute(context.Background(), pipe.NewPiped("true"), nil, nil, nil))
+	require.NoError(t, m.Shutdown(context.Background()))
+}
@@ -0,0 +1,85 @@
+package pipe
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// RunMetrics summarizes one run of a pipeline, for exporting to a metrics system.
+type RunMetrics struct {
+	// Command is the command of the head of the pipeline, a low cardinality name fit for a metric label
+	Command  string
+	Duration time.Duration
+	// ExitCode is zero if the pipeline succeeded, the exit code of the stage it failed because of if that stage exited,
+	// and -1 otherwise
+	ExitCode int
+	Err      error
+	// OutputBytes is how many bytes the pipeline wrote to stdout
+	OutputBytes int64
+}
+
+// WithMetricsCallback calls f once at the end of every run of the pipeline, including runs that fail to start, so it
+// can be recorded in a metrics system.  The package does not depend on one; with Prometheus it looks like
+//
+//	p.WithMetricsCallback(func(m pipe.RunMetrics) {
+//		durations.WithLabelValues(m.Command).Observe(m.Duration.Seconds())
+//		exits.WithLabelValues(m.Command, strconv.Itoa(m.ExitCode)).Inc()
+//		outputBytes.WithLabelValues(m.Command).Add(float64(m.OutputBytes))
+//	})
+func (p *PipedCmd) WithMetricsCallback(f func(m RunMetrics)) *PipedCmd {
+	return p.setOption(func(o *options) {
+		o.onMetrics = f
+	})
+}
+
+// observeRun reports a finished run to the metrics callback, if there is one.
+func (e *execution) observeRun(err error) {
+	if e.opts.onMetrics == nil {
+		return
+	}
+	m := RunMetrics{
+		Command:  e.command,
+		Duration: time.Since(e.started),
+		ExitCode: -1,
+		Err:      err,
+	}
+	if e.written != nil {
+		m.OutputBytes = e.written.n.Load()
+	}
+	var pipeErr *PipelineError
+	switch {
+	case err == nil:
+		m.ExitCode = 0
+	case errors.As(err, &pipeErr):
+		m.ExitCode = pipeErr.ExitCode
+	}
+	e.opts.onMetrics(m)
+}
+
+// RunCountingOutput runs the pipeline like Run, but with its output going to w, and returns how many bytes it wrote
+// to w.  The count is returned even if the pipeline fails.  w may be nil to only count the output.
+func (p *PipedCmd) RunCountingOutput(ctx context.Context, w io.Writer) (int64, error) {
+	c := &countingWriter{w: w}
+	err := p.Execute(ctx, nil, c, os.Stderr)
+	return c.n.Load(), err
+}
+
+// countingWriter counts the bytes written through it to w, which may be nil to count output that is thrown away.
+type countingWriter struct {
+	w io.Writer
+	n atomic.Int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	if c.w == nil {
+		c.n.Add(int64(len(p)))
+		return len(p), nil
+	}
+	n, err := c.w.Write(p)
+	c.n.Add(int64(n))
+	return n, err
+}
@@ -0,0 +1,64 @@
+package pipe_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/cresta/pipe"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsCallback(t *testing.T) {
+	var runs []pipe.RunMetrics
+	record := func(m pipe.RunMetrics) {
+		runs = append(runs, m)
+	}
+	require.NoError(t, pipe.NewPiped("echo", "hello").Pipe("cat").WithMetricsCallback(record).
+		Execute(context.Background(), nil, nil, nil))
+	require.Error(t, pipe.NewPiped("sh", "-c", "exit 3").WithMetricsCallback(record).
+		Execute(context.Background(), nil, nil, nil))
+	require.Error(t, pipe.NewPiped("/does/not/exist").WithMetricsCallback(record).
+		Execute(context.Background(), nil, nil, nil))
+
+	require.Len(t, runs, 3)
+	require.Equal(t, "echo", runs[0].Command)
+	require.Equal(t, 0, runs[0].ExitCode)
+	require.Equal(t, int64(6), runs[0].OutputBytes)
+	require.Positive(t, runs[0].Duration)
+	require.NoError(t, runs[0].Err)
+
+	require.Equal(t, "sh", runs[1].Command)
+	require.Equal(t, 3, runs[1].ExitCode)
+	require.Error(t, runs[1].Err)
+
+	require.Equal(t, "/does/not/exist", runs[2].Command)
+	require.Equal(t, -1, runs[2].ExitCode)
+}
+
+func TestRunCountingOutput(t *testing.T) {
+	var buf bytes.Buffer
+	n, err := pipe.NewPiped("seq", "1000").RunCountingOutput(context.Background(), &buf)
+	require.NoError(t, err)
+	require.Equal(t, int64(buf.Len()), n)
+	require.Equal(t, int64(3893), n)
+
+	n, err = pipe.NewPiped("sh", "-c", "printf abc; exit 1").RunCountingOutput(context.Background(), nil)
+	require.Error(t, err)
+	require.Equal(t, int64(3), n)
+}
+
+func TestMetricsCallbackWithFlushOnNewline(t *testing.T) {
+	var w countingFlusher
+	var runs []pipe.RunMetrics
+	err := pipe.NewPiped("sh", "-c", "echo a; sleep 0.1; echo b").
+		WithFlushOnNewline().
+		WithMetricsCallback(func(m pipe.RunMetrics) {
+			runs = append(runs, m)
+		}).
+		Execute(context.Background(), nil, &w, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a\n", "a\nb\n", "a\nb\n"}, w.flushed)
+	require.Len(t, runs, 1)
+	require.Equal(t, int64(4), runs[0].OutputBytes)
+}
@@ -0,0 +1,84 @@
+package pipe
+
+import (
+	"io"
+	"os"
+	"time"
+)
+
+// options are settings that apply to the whole pipeline rather than a single stage.  They may be set on any stage of
+// the chain and are collected, head first, when the pipeline runs, so a later stage wins if two stages set the same
+// option.
+type options struct {
+	maxTokenSize int
+	idleTimeout  time.Duration
+	logger       Logger
+	decoder      Decoder
+	forceTTY     bool
+	onStageExit  func(stage int, code int, err error)
+	// onStageState is called with the state of each stage that ran, for platform specific callbacks like
+	// WithRusageCallback
+	onStageState    func(stage int, state *os.ProcessState)
+	discardOnCancel bool
+	resolveShebang  bool
+	bufferStages    bool
+	// maxConcurrentStages only applies with bufferStages
+	maxConcurrentStages int
+	onNotFound          func(cmd string) error
+	stats               *PipelineStats
+	stdinPipe           bool
+	pipeReadTimeout     time.Duration
+	flushOnNewline      bool
+	exitStatus          ExitStatus
+	envConflict         EnvConflictPolicy
+	stdoutErrorPolicy   StdoutErrorPolicy
+	onMetrics           func(m RunMetrics)
+	tempDir             bool
+	envRewriter         func(env []string) []string
+	binaryLogEncoding   BinaryLogEncoding
+	braceExpansion      bool
+	onEmptyOutput       func(stage int)
+	combinedOutput      bool
+	captureEnv          bool
+	teeFiles            []string
+	// stdout is where the output goes when the pipeline is not given anywhere else
+	stdout io.Writer
+	// openStdin, if set, opens what the head of the pipeline reads instead of the stdin it was run with
+	openStdin      func() (io.ReadCloser, error)
+	maxInputBytes  int64
+	stdinTransform func(io.Reader) io.Reader
+}
+
+func (p *PipedCmd) setOption(f func(o *options)) *PipedCmd {
+	p.opts = append(p.opts, f)
+	return p
+}
+
+func (p *PipedCmd) head() *PipedCmd {
+	h := p
+	for h.readFrom != nil {
+		h = h.readFrom
+	}
+	return h
+}
+
+func (p *PipedCmd) options() *options {
+	o := &options{}
+	for current := p.head(); current != nil; current = current.pipeTo {
+		for _, f := range current.opts {
+			f(o)
+		}
+		if current == p {
+			break
+		}
+	}
+	return o
+}
+
+// WithMaxTokenSize sets the largest token RunSplit and RunLines will accept from the output.  Larger tokens fail the
+// run with bufio.ErrTooLong.  The default is bufio.MaxScanTokenSize.
+func (p *PipedCmd) WithMaxTokenSize(n int) *PipedCmd {
+	return p.setOption(func(o *options) {
+		o.maxTokenSize = n
+	})
+}
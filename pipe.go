@@ -2,11 +2,14 @@ package pipe
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
+	"path/filepath"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/google/shlex"
 )
@@ -18,8 +21,21 @@ type PipedCmd struct {
 	dir      string
 	readFrom *PipedCmd
 	pipeTo   *PipedCmd
+	envEdits []func(env []string) []string
+	opts     []func(o *options)
+	// pipeStderr sends this stage's stderr, rather than its stdout, to pipeTo
+	pipeStderr bool
+	timeout    time.Duration
+	// unblockSignals are signals this stage must not inherit an ignored disposition for
+	unblockSignals []os.Signal
+	// fallback is run by RunWithFallback if the pipeline ending here fails
+	fallback *PipedCmd
+	executed atomic.Bool
 }
 
+// ErrAlreadyExecuted is returned when a pipeline that has already been run is run again.
+var ErrAlreadyExecuted = errors.New("this pipeline has already been executed; build a new one or call Clone()")
+
 func NewPiped(cmd string, args ...string) *PipedCmd {
 	return &PipedCmd{
 		cmd:  cmd,
@@ -49,6 +65,15 @@ func Shell(fullLine string) *PipedCmd {
 }
 
 func ShellWithError(fullLine string) (*PipedCmd, error) {
+	return ShellWithSources(fullLine, os.LookupEnv)
+}
+
+// ShellWithSources is like ShellWithError, but resolves variables from sources instead of this process's environment.
+// Assignments at the front of the line are checked first, then each source in order, and the first source that has
+// the variable wins.  Variables no source has expand to the empty string.
+//
+//	ShellWithSources("deploy $ENV", MapSource(overrides), os.LookupEnv, MapSource(defaults))
+func ShellWithSources(fullLine string, sources ...func(string) (string, bool)) (*PipedCmd, error) {
 	parts, err := shlex.Split(fullLine)
 	if err != nil {
 		return nil, err
@@ -80,7 +105,12 @@ func ShellWithError(fullLine string) (*PipedCmd, error) {
 			if v, exists := envMap[s]; exists {
 				return v
 			}
-			return os.Getenv(s)
+			for _, source := range sources {
+				if v, exists := source(s); exists {
+					return v
+				}
+			}
+			return ""
 		})
 	}
 
@@ -91,36 +121,169 @@ func ShellWithError(fullLine string) (*PipedCmd, error) {
 	}, nil
 }
 
+// MapSource returns a variable source for ShellWithSources that looks variables up in m.
+func MapSource(m map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, exists := m[key]
+		return v, exists
+	}
+}
+
+// ValidateShell checks that every variable line references can be resolved, when building it with Shell would
+// silently expand the rest to the empty string.  Variables can come from this process's environment or from
+// assignments at the front of the line.  Nothing is run.  The error names every undefined variable, to catch typos in
+// templated command lines when the config is loaded rather than when it is used.
+func ValidateShell(line string) error {
+	var missing []string
+	_, err := ShellWithSources(line, os.LookupEnv, func(key string) (string, bool) {
+		for _, m := range missing {
+			if m == key {
+				return "", true
+			}
+		}
+		missing = append(missing, key)
+		return "", true
+	})
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("undefined variables in %q: %s", line, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// Clone returns a copy of the pipeline ending at p that has not been executed, and so can be run even if p was.
+func (p *PipedCmd) Clone() *PipedCmd {
+	var ret *PipedCmd
+	for _, s := range p.stages() {
+		next := &PipedCmd{
+			cmd:            s.cmd,
+			args:           append([]string(nil), s.args...),
+			dir:            s.dir,
+			envEdits:       append(([]func(env []string) []string)(nil), s.envEdits...),
+			opts:           append(([]func(o *options))(nil), s.opts...),
+			pipeStderr:     s.pipeStderr,
+			timeout:        s.timeout,
+			unblockSignals: append([]os.Signal(nil), s.unblockSignals...),
+		}
+		if s.env != nil {
+			next.env = append([]string{}, s.env...)
+		}
+		if s.fallback != nil {
+			next.fallback = s.fallback.Clone()
+		}
+		if ret != nil {
+			next = ret.PipeTo(next)
+		}
+		ret = next
+	}
+	return ret
+}
+
+// Equal reports if p and other are parts of pipelines with the same stages: the same commands, arguments, environments
+// and directories, connected the same way.  Whether either has been run does not matter.  Environment edits such as
+// WithEnvVar are funcs and options are not compared, so pipelines differing only in those are equal.
+func (p *PipedCmd) Equal(other *PipedCmd) bool {
+	stages, others := p.allStages(), other.allStages()
+	if len(stages) != len(others) {
+		return false
+	}
+	for i, s := range stages {
+		o := others[i]
+		if s.cmd != o.cmd || s.dir != o.dir || s.pipeStderr != o.pipeStderr || s.timeout != o.timeout ||
+			!stringsEqual(s.args, o.args) || (s.env == nil) != (o.env == nil) || !stringsEqual(s.env, o.env) {
+			return false
+		}
+	}
+	return true
+}
+
+func stringsEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
 func (p *PipedCmd) WithEnv(e []string) *PipedCmd {
 	p.env = e
 	return p
 }
 
+// WithDir runs the stage in d.  Stages without a directory of their own run in the directory of the last stage.
 func (p *PipedCmd) WithDir(d string) *PipedCmd {
 	p.dir = d
 	return p
 }
 
+// WithDirExpanded is like WithDir, but first expands $VAR and ${VAR} from this process's environment, the way Shell
+// expands arguments, and a leading ~ to the user's home directory.
+//
+//	WithDirExpanded("~/src/$PROJECT")
+func (p *PipedCmd) WithDirExpanded(d string) *PipedCmd {
+	if d == "~" || strings.HasPrefix(d, "~/") || strings.HasPrefix(d, "~"+string(filepath.Separator)) {
+		if home, err := os.UserHomeDir(); err == nil {
+			d = home + d[1:]
+		}
+	}
+	return p.WithDir(os.ExpandEnv(d))
+}
+
 func (p *PipedCmd) Shell(fullLine string) *PipedCmd {
 	next := Shell(fullLine)
 	return p.PipeTo(next)
 }
 
-func (p *PipedCmd) PipeTo(into *PipedCmd) *PipedCmd {
-	if p.readFrom != nil {
-		panic("pipe already set to read")
+// MaxStages is the most stages a pipeline may have, to stop pipelines built from untrusted config exhausting resources
+// with an enormous chain.  PipeTo and InsertStage panic with ErrTooManyStages rather than exceed it, and pipelines
+// that have more stages than it fail to run.  It is not safe to change while pipelines are being built or run.
+var MaxStages = 256
+
+// ErrTooManyStages is the error, wrapped, of pipelines with more than MaxStages stages.
+var ErrTooManyStages = errors.New("pipeline has too many stages")
+
+// checkStages returns ErrTooManyStages, wrapped, if n stages is more than MaxStages.
+func checkStages(n int) error {
+	if n > MaxStages {
+		return fmt.Errorf("%w: %d is more than MaxStages (%d)", ErrTooManyStages, n, MaxStages)
 	}
+	return nil
+}
+
+func (p *PipedCmd) PipeTo(into *PipedCmd) *PipedCmd {
 	if p.pipeTo != nil {
 		panic("pipe already set to pipe to")
 	}
 	if into.readFrom != nil {
 		panic("into is already set to read")
 	}
+	for current := p; current != nil; current = current.readFrom {
+		if current == into {
+			panic("into is already in the pipeline")
+		}
+	}
+	if err := checkStages(len(p.stages()) + len(into.allStages())); err != nil {
+		panic(err)
+	}
 	into.readFrom = p
 	p.pipeTo = into
 	return into
 }
 
+// PipeStderrTo is like PipeTo, but sends p's stderr to into instead of its stdout, which is thrown away.  It is the
+// shell's "p 2>&1 >/dev/null | into", for tools that write what you want on stderr.
+func (p *PipedCmd) PipeStderrTo(into *PipedCmd) *PipedCmd {
+	ret := p.PipeTo(into)
+	p.pipeStderr = true
+	return ret
+}
+
 func (p *PipedCmd) Pipe(cmd string, args ...string) *PipedCmd {
 	return p.PipeTo(&PipedCmd{
 		cmd:  cmd,
@@ -128,59 +291,44 @@ func (p *PipedCmd) Pipe(cmd string, args ...string) *PipedCmd {
 	})
 }
 
+// describe names the commands of the pipeline for messages, like "find | grep".
+func (p *PipedCmd) describe() string {
+	var names []string
+	for _, s := range p.stages() {
+		names = append(names, s.cmd)
+	}
+	return strings.Join(names, " | ")
+}
+
+// To sends the pipeline's output to w, so it can be captured without passing w to Execute:
+//
+//	var buf bytes.Buffer
+//	err := Shell("git rev-parse HEAD").To(&buf).Run(ctx)
+//
+// Run writes to w instead of os.Stdout, and so does Execute when it is given a nil stdout.  A stdout passed to Execute
+// wins over w, as it does for helpers like RunReader and Decode that capture the output themselves.
+func (p *PipedCmd) To(w io.Writer) *PipedCmd {
+	return p.setOption(func(o *options) {
+		o.stdout = w
+	})
+}
+
 func (p *PipedCmd) Run(ctx context.Context) error {
-	return p.Execute(ctx, nil, os.Stdout, os.Stderr)
+	return p.Execute(ctx, nil, p.defaultStdout(), os.Stderr)
 }
 
-func (p *PipedCmd) Execute(ctx context.Context, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
-	cmdCtx, withCancel := context.WithCancel(ctx)
-	defer withCancel()
-	// Setup and start each command
-	commands := make([]*exec.Cmd, 0)
-	for current := p; current != nil; current = current.readFrom {
-		//nolint:gosec
-		cmd := exec.CommandContext(cmdCtx, current.cmd, current.args...)
-		cmd.Stderr = stderr
-		cmd.Env = current.env
-		cmd.Dir = p.dir
-		// put the last Pipe() at the first of commands
-		commands = append([]*exec.Cmd{cmd}, commands...)
-	}
-	for idx := range commands {
-		if idx == 0 {
-			commands[idx].Stdin = stdin
-		} else {
-			p, err := commands[idx-1].StdoutPipe()
-			if err != nil {
-				return fmt.Errorf("unable to get stdout pipe: %w", err)
-			}
-			commands[idx].Stdin = p
-		}
-		if idx == len(commands)-1 {
-			commands[idx].Stdout = stdout
-		}
+// defaultStdout is where Run and the helpers like it write the pipeline's output: the writer set with To, or os.Stdout.
+func (p *PipedCmd) defaultStdout() io.Writer {
+	if w := p.options().stdout; w != nil {
+		return w
 	}
-	for idx, cmd := range commands {
-		if err := cmd.Start(); err != nil {
-			withCancel()
-			// Wait for the previous commands to finish so we do not leak
-			for i := 0; i < idx; i++ {
-				_ = commands[i].Wait()
-			}
-			return fmt.Errorf("unable to start command: %w", err)
-		}
-	}
-	var waitErr error
-	for i := len(commands) - 1; i >= 0; i-- {
-		// https://golang.org/pkg/os/exec/#Cmd.StdoutPipe
-		// "It is thus incorrect to call Wait before all reads from the pipe have completed"
-		// So we need to Wait for the last in the chain first
-		cmd := commands[i]
-		if err := cmd.Wait(); err != nil {
-			// We will end up returning the *last* wait error, which will be the first command of the pipes that failed
-			waitErr = err
-			withCancel()
-		}
+	return os.Stdout
+}
+
+func (p *PipedCmd) Execute(ctx context.Context, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+	e, err := p.start(ctx, stdin, stdout, stderr)
+	if err != nil {
+		return err
 	}
-	return waitErr
+	return e.wait()
 }
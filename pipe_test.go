@@ -3,6 +3,9 @@ package pipe_test
 import (
 	"bytes"
 	"context"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/cresta/pipe"
@@ -30,3 +33,171 @@ func TestPipeTo(t *testing.T) {
 	require.NoError(t, pipe.Shell("echo hi").PipeTo(pipe.NewPiped("cat")).Execute(context.Background(), nil, &buf, nil))
 	require.Contains(t, buf.String(), "hi")
 }
+
+func TestPipeToExtendsPipeline(t *testing.T) {
+	var buf bytes.Buffer
+	p := pipe.Shell("echo hi").PipeTo(pipe.NewPiped("tr", "a-z", "A-Z")).PipeTo(pipe.NewPiped("cat"))
+	require.NoError(t, p.Execute(context.Background(), nil, &buf, nil))
+	require.Equal(t, "HI\n", buf.String())
+}
+
+func TestPipeToCycle(t *testing.T) {
+	a := pipe.NewPiped("cat")
+	b := a.Pipe("cat")
+	require.Panics(t, func() { b.PipeTo(a) })
+	c := pipe.NewPiped("cat")
+	require.Panics(t, func() { c.PipeTo(c) })
+}
+
+func TestStageDirs(t *testing.T) {
+	first, last := t.TempDir(), t.TempDir()
+	var buf bytes.Buffer
+	err := pipe.NewPiped("pwd").WithDir(first).Pipe("sh", "-c", "cat; pwd").Pipe("sh", "-c", "cat; pwd").WithDir(last).
+		Execute(context.Background(), nil, &buf, nil)
+	require.NoError(t, err)
+	require.Equal(t, first+"\n"+last+"\n"+last+"\n", buf.String())
+}
+
+func TestShellWithSources(t *testing.T) {
+	first := pipe.MapSource(map[string]string{"A": "first"})
+	second := pipe.MapSource(map[string]string{"A": "second", "B": "second"})
+	third := pipe.MapSource(map[string]string{"A": "third", "B": "third", "C": "third"})
+	cmd, err := pipe.ShellWithSources("A=inline echo $A $B $C$D", first, second, third)
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, cmd.Execute(context.Background(), nil, &buf, nil))
+	require.Equal(t, "inline second third\n", buf.String())
+
+	cmd, err = pipe.ShellWithSources("echo $A", third, first)
+	require.NoError(t, err)
+	buf.Reset()
+	require.NoError(t, cmd.Execute(context.Background(), nil, &buf, nil))
+	require.Equal(t, "third\n", buf.String())
+}
+
+func TestExecuteTwice(t *testing.T) {
+	p := pipe.Shell("echo hi").Pipe("cat")
+	require.NoError(t, p.Execute(context.Background(), nil, nil, nil))
+	err := p.Execute(context.Background(), nil, nil, nil)
+	require.ErrorIs(t, err, pipe.ErrAlreadyExecuted)
+	require.Contains(t, err.Error(), "Clone()")
+}
+
+func TestClone(t *testing.T) {
+	p := pipe.Shell("echo hi").Pipe("cat")
+	require.NoError(t, p.Execute(context.Background(), nil, nil, nil))
+	var buf bytes.Buffer
+	require.NoError(t, p.Clone().Execute(context.Background(), nil, &buf, nil))
+	require.Equal(t, "hi\n", buf.String())
+	require.Equal(t, p.Quoted(), p.Clone().Quoted())
+}
+
+func TestPipeStderrTo(t *testing.T) {
+	var buf bytes.Buffer
+	p := pipe.NewPiped("sh", "-c", "echo out; echo err >&2").PipeStderrTo(pipe.NewPiped("tr", "a-z", "A-Z"))
+	require.NoError(t, p.Execute(context.Background(), nil, &buf, nil))
+	require.Equal(t, "ERR\n", buf.String())
+	require.Equal(t, `sh -c 'echo out; echo err >&2' 2>&1 >/dev/null | tr a-z A-Z`, p.Quoted())
+}
+
+func TestPipeStderrToConflictsWithPipe(t *testing.T) {
+	p := pipe.NewPiped("echo", "hi")
+	p.Pipe("cat")
+	require.Panics(t, func() {
+		p.PipeStderrTo(pipe.NewPiped("cat"))
+	})
+}
+
+func TestPipeThreeStages(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, pipe.Shell("echo hi").Pipe("cat").Pipe("tr", "a-z", "A-Z").Execute(context.Background(), nil, &buf, nil))
+	require.Equal(t, "HI\n", buf.String())
+}
+
+func TestWithDirExpanded(t *testing.T) {
+	home, err := os.UserHomeDir()
+	require.NoError(t, err)
+	var out bytes.Buffer
+	require.NoError(t, pipe.NewPiped("pwd").WithDirExpanded("$HOME").Execute(context.Background(), nil, &out, nil))
+	require.Equal(t, home, strings.TrimSpace(out.String()))
+
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "work"), 0o755))
+	t.Setenv("HOME", dir)
+	t.Setenv("WORKDIR", "work")
+	out.Reset()
+	require.NoError(t, pipe.NewPiped("pwd").WithDirExpanded("~/${WORKDIR}").Execute(context.Background(), nil, &out, nil))
+	require.Equal(t, filepath.Join(dir, "work"), strings.TrimSpace(out.String()))
+}
+
+func TestEqual(t *testing.T) {
+	build := func() *pipe.PipedCmd {
+		return pipe.Shell("FOO=bar echo a b").WithDir(os.TempDir()).Pipe("sort", "-r")
+	}
+	a, b := build(), build()
+	require.True(t, a.Equal(b))
+	require.NoError(t, a.Execute(context.Background(), nil, nil, nil))
+	require.True(t, a.Equal(b))
+	require.True(t, a.Equal(a.Clone()))
+
+	require.False(t, a.Equal(pipe.Shell("FOO=bar echo a b").WithDir(os.TempDir()).Pipe("sort")))
+	require.False(t, a.Equal(pipe.Shell("FOO=baz echo a b").WithDir(os.TempDir()).Pipe("sort", "-r")))
+	require.False(t, a.Equal(pipe.Shell("FOO=bar echo a b").Pipe("sort", "-r")))
+	require.False(t, a.Equal(pipe.Shell("FOO=bar echo a b").WithDir(os.TempDir())))
+	require.False(t, pipe.NewPiped("env").Equal(pipe.NewPiped("env").WithEnv([]string{})))
+}
+
+func TestValidateShell(t *testing.T) {
+	t.Setenv("PIPE_TEST_DEFINED", "yes")
+	require.NoError(t, pipe.ValidateShell("echo $PIPE_TEST_DEFINED"))
+	require.NoError(t, pipe.ValidateShell("NAME=world echo hello $NAME"))
+
+	err := pipe.ValidateShell("echo $PIPE_TEST_UNDEFINED ${PIPE_TEST_TYPO} $PIPE_TEST_UNDEFINED $PIPE_TEST_DEFINED")
+	require.Error(t, err)
+	require.True(t, strings.HasSuffix(err.Error(), ": PIPE_TEST_UNDEFINED, PIPE_TEST_TYPO"), err.Error())
+
+	require.Error(t, pipe.ValidateShell("echo 'unterminated"))
+}
+
+func TestTo(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, pipe.Shell("echo hello").Pipe("tr", "a-z", "A-Z").To(&buf).Run(context.Background()))
+	require.Equal(t, "HELLO\n", buf.String())
+
+	var to, given bytes.Buffer
+	require.NoError(t, pipe.Shell("echo hello").To(&to).Execute(context.Background(), nil, &given, nil))
+	require.Empty(t, to.String())
+	require.Equal(t, "hello\n", given.String())
+}
+
+func TestMaxStages(t *testing.T) {
+	p := pipe.NewPiped("echo", "hi")
+	for i := 1; i < pipe.MaxStages; i++ {
+		p = p.Pipe("cat")
+	}
+	require.PanicsWithError(t, "pipeline has too many stages: 257 is more than MaxStages (256)", func() {
+		p.Pipe("cat")
+	})
+	require.Panics(t, func() { p.InsertStage(1, "cat") })
+}
+
+func TestMaxStagesConfigurable(t *testing.T) {
+	old := pipe.MaxStages
+	pipe.MaxStages = 2
+	defer func() { pipe.MaxStages = old }()
+	p := pipe.NewPiped("echo", "hi").Pipe("cat")
+	defer func() {
+		err, _ := recover().(error)
+		require.ErrorIs(t, err, pipe.ErrTooManyStages)
+	}()
+	p.Pipe("cat")
+	t.Fatal("expected a panic")
+}
+
+func TestMaxStagesLoweredAfterBuilding(t *testing.T) {
+	p := pipe.NewPiped("echo", "hi").Pipe("cat").Pipe("cat")
+	old := pipe.MaxStages
+	pipe.MaxStages = 2
+	defer func() { pipe.MaxStages = old }()
+	require.ErrorIs(t, p.Run(context.Background()), pipe.ErrTooManyStages)
+}
@@ -0,0 +1,86 @@
+package pipe
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+)
+
+// RunReader starts the pipeline and returns its stdout as a reader, for handing to parsers that want an io.Reader
+// such as encoding/csv or archive/tar.  Once the output is read to the end the reader returns io.EOF if the pipeline
+// succeeded, or the pipeline's error if it failed.
+//
+// The caller must Close the reader.  Closing it before the end kills the pipeline, and Close always waits for the
+// pipeline to exit.  Close returns the pipeline's error if it finished on its own, and nil if Close stopped it.
+func (p *PipedCmd) RunReader(ctx context.Context) (io.ReadCloser, error) {
+	return p.RunStream(ctx)
+}
+
+// RunStream is like RunReader, but returns a Stream, whose OutputReader gives finer control over parsing the output.
+func (p *PipedCmd) RunStream(ctx context.Context) (*Stream, error) {
+	cmdCtx, withCancel := context.WithCancel(ctx)
+	pr, pw := io.Pipe()
+	e, err := p.start(cmdCtx, nil, pw, os.Stderr)
+	if err != nil {
+		withCancel()
+		return nil, err
+	}
+	r := &Stream{
+		pr:         pr,
+		buf:        bufio.NewReader(pr),
+		withCancel: withCancel,
+		done:       make(chan struct{}),
+	}
+	go func() {
+		r.err = e.wait()
+		// Done before the reader ends, so a Close after reading to the end knows the pipeline finished on its own
+		close(r.done)
+		_ = pw.CloseWithError(r.err)
+	}()
+	return r, nil
+}
+
+// Stream is the stdout of a pipeline started by RunStream.  It is read and closed the same way as the reader from
+// RunReader.
+type Stream struct {
+	pr         *io.PipeReader
+	buf        *bufio.Reader
+	withCancel context.CancelFunc
+	done       chan struct{}
+	err        error
+}
+
+func (r *Stream) Read(p []byte) (int, error) {
+	return r.buf.Read(p)
+}
+
+// OutputReader returns a bufio.Reader over the pipeline's stdout, for protocols that need ReadString, ReadBytes or
+// Peek rather than a callback for each line.  Read on the Stream reads through the same buffer, so the two can be
+// mixed.  The reader ends with io.EOF if the pipeline succeeded or the pipeline's error if it failed, and the Stream
+// must still be closed once done with, to wait for the pipeline.
+//
+//	out := s.OutputReader()
+//	for {
+//		line, err := out.ReadString('\n')
+//		...
+//	}
+func (r *Stream) OutputReader() *bufio.Reader {
+	return r.buf
+}
+
+func (r *Stream) Close() error {
+	var finished bool
+	select {
+	case <-r.done:
+		finished = true
+	default:
+	}
+	_ = r.pr.Close()
+	r.withCancel()
+	<-r.done
+	if !finished {
+		return nil
+	}
+	return r.err
+}
@@ -0,0 +1,76 @@
+package pipe_test
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"testing"
+
+	"github.com/cresta/pipe"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunReader(t *testing.T) {
+	r, err := pipe.Shell("printf 'a,b\\nc,d\\n'").RunReader(context.Background())
+	require.NoError(t, err)
+	records, err := csv.NewReader(r).ReadAll()
+	require.NoError(t, err)
+	require.Equal(t, [][]string{{"a", "b"}, {"c", "d"}}, records)
+	require.NoError(t, r.Close())
+}
+
+func TestRunReaderFailure(t *testing.T) {
+	r, err := pipe.Shell("sh -c 'echo partial; exit 3'").RunReader(context.Background())
+	require.NoError(t, err)
+	b, err := io.ReadAll(r)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "exit status 3")
+	require.Equal(t, "partial\n", string(b))
+	require.Error(t, r.Close())
+}
+
+func TestRunReaderFailureClosedAfterEnd(t *testing.T) {
+	for i := 0; i < 50; i++ {
+		r, err := pipe.NewPiped("false").RunReader(context.Background())
+		require.NoError(t, err)
+		_, readErr := io.ReadAll(r)
+		require.Error(t, readErr)
+		require.Equal(t, readErr, r.Close())
+	}
+}
+
+func TestRunReaderCloseEarly(t *testing.T) {
+	r, err := pipe.Shell("yes").RunReader(context.Background())
+	require.NoError(t, err)
+	buf := make([]byte, 2)
+	_, err = io.ReadFull(r, buf)
+	require.NoError(t, err)
+	require.Equal(t, "y\n", string(buf))
+	require.NoError(t, r.Close())
+}
+
+func TestStreamOutputReader(t *testing.T) {
+	s, err := pipe.NewPiped("seq", "5").RunStream(context.Background())
+	require.NoError(t, err)
+	out := s.OutputReader()
+	var lines []string
+	for {
+		line, err := out.ReadString('\n')
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		lines = append(lines, line)
+	}
+	require.Equal(t, []string{"1\n", "2\n", "3\n", "4\n", "5\n"}, lines)
+	require.NoError(t, s.Close())
+}
+
+func TestStreamOutputReaderCloseEarly(t *testing.T) {
+	s, err := pipe.Shell("yes").RunStream(context.Background())
+	require.NoError(t, err)
+	b, err := s.OutputReader().Peek(4)
+	require.NoError(t, err)
+	require.Equal(t, "y\ny\n", string(b))
+	require.NoError(t, s.Close())
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package pipe
+
+import "syscall"
+
+// WithRusageCallback would call f with the resource usage of each stage as it exits, but this platform's kernel does
+// not report resource usage in that form, so f is never called.  It exists so code using it builds everywhere.
+func (p *PipedCmd) WithRusageCallback(f func(stage int, r *syscall.Rusage)) *PipedCmd {
+	return p
+}
@@ -0,0 +1,21 @@
+//go:build !unix
+
+package pipe_test
+
+import (
+	"context"
+	"syscall"
+	"testing"
+
+	"github.com/cresta/pipe"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRusageCallbackNeverCalled(t *testing.T) {
+	called := false
+	err := pipe.NewPiped("cmd", "/c", "echo hi").WithRusageCallback(func(stage int, r *syscall.Rusage) {
+		called = true
+	}).Execute(context.Background(), nil, nil, nil)
+	require.NoError(t, err)
+	require.False(t, called)
+}
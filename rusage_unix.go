@@ -0,0 +1,24 @@
+//go:build unix
+
+package pipe
+
+import (
+	"os"
+	"syscall"
+)
+
+// WithRusageCallback calls f with the resource usage of each stage as it exits: its CPU time, maximum resident set
+// size, page faults, context switches and so on.  It is called from the same goroutines as WithStageExitCallback, and
+// never for two stages at once.  Stages that never started are skipped.
+//
+// It is only supported on Unix, where the kernel reports resource usage for child processes.  Elsewhere f is never
+// called.
+func (p *PipedCmd) WithRusageCallback(f func(stage int, r *syscall.Rusage)) *PipedCmd {
+	return p.setOption(func(o *options) {
+		o.onStageState = func(stage int, state *os.ProcessState) {
+			if r, ok := state.SysUsage().(*syscall.Rusage); ok {
+				f(stage, r)
+			}
+		}
+	})
+}
@@ -0,0 +1,27 @@
+//go:build unix
+
+package pipe_test
+
+import (
+	"context"
+	"syscall"
+	"testing"
+
+	"github.com/cresta/pipe"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRusageCallback(t *testing.T) {
+	usage := map[int]*syscall.Rusage{}
+	err := pipe.NewPiped("sh", "-c", "i=0; while [ $i -lt 10000 ]; do i=$((i+1)); done; echo $i").
+		Pipe("cat").
+		WithRusageCallback(func(stage int, r *syscall.Rusage) {
+			usage[stage] = r
+		}).
+		Execute(context.Background(), nil, nil, nil)
+	require.NoError(t, err)
+	require.Len(t, usage, 2)
+	require.NotNil(t, usage[0])
+	require.Positive(t, usage[0].Maxrss)
+	require.Positive(t, usage[0].Utime.Nano()+usage[0].Stime.Nano())
+}
@@ -0,0 +1,254 @@
+package pipe
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Quoted returns the pipeline as one shell command line, quoting anything a shell would otherwise split or expand.
+// Environment assignments of each stage are written in front of its command, the way Shell parses them.  Directories
+// and environment edits such as PrependPath are not shown; see ToShellScript for a complete rendering.
+func (p *PipedCmd) Quoted() string {
+	stages := p.stages()
+	parts := make([]string, 0, len(stages))
+	for _, s := range stages {
+		parts = append(parts, quoteCommand(s.env, s.cmd, s.args))
+	}
+	return joinStages(stages, parts)
+}
+
+// SafeCommand runs template with sh -c, after replacing each %s in it with the next of args quoted as a single shell
+// word, for the cases that really need a shell.  However args are written, the shell sees each one as one literal
+// argument that is never expanded or run, so untrusted input cannot break out of the command template intends.  %% is
+// replaced with a single %, and nothing else in template is changed.  It panics if template does not have exactly
+// one %s for each of args, or if a %s is somewhere its quoting would not hold: inside quotes or backticks, after a
+// backslash, in a comment or anywhere after a << heredoc, whose body the shell expands whatever the quotes.  $(...) is
+// fine.
+//
+//	SafeCommand("grep -r %s . | wc -l", userInput)
+func SafeCommand(template string, args ...string) *PipedCmd {
+	var b strings.Builder
+	var s templateScanner
+	used := 0
+	for i := 0; i < len(template); i++ {
+		if template[i] != '%' || i+1 == len(template) {
+			s.next(template, i)
+			b.WriteByte(template[i])
+			continue
+		}
+		switch template[i+1] {
+		case '%':
+			b.WriteByte('%')
+			i++
+		case 's':
+			if where := s.where(); where != "" {
+				panic(fmt.Sprintf("command template %q has a placeholder %s", template, where))
+			}
+			if used < len(args) {
+				b.WriteString(shellQuote(args[used]))
+			}
+			used++
+			i++
+		default:
+			b.WriteByte('%')
+		}
+	}
+	if used != len(args) {
+		panic(fmt.Sprintf("command template %q has %d placeholders for %d args", template, used, len(args)))
+	}
+	return NewPiped("sh", "-c", b.String())
+}
+
+// templateScanner follows the shell's quoting through a SafeCommand template, to tell if a placeholder can be replaced
+// with a quoted word.
+type templateScanner struct {
+	// quote is the ', " or ` the scanner is inside, if any
+	quote   byte
+	escaped bool
+	comment bool
+	// less is set just after an unquoted <, and heredoc once a << has been seen
+	less    bool
+	heredoc bool
+}
+
+// next moves the scanner past template[i].
+func (s *templateScanner) next(template string, i int) {
+	c := template[i]
+	afterLess := s.less
+	s.less = false
+	switch {
+	case s.escaped:
+		s.escaped = false
+	case s.comment:
+		s.comment = c != '\n'
+	case s.quote == '\'':
+		if c == '\'' {
+			s.quote = 0
+		}
+	case s.quote != 0:
+		if c == '\\' {
+			s.escaped = true
+		} else if c == s.quote {
+			s.quote = 0
+		}
+	case c == '\\':
+		s.escaped = true
+	case c == '\'' || c == '"' || c == '`':
+		s.quote = c
+	case c == '#':
+		s.comment = i == 0 || strings.IndexByte(" \t\n;&|()", template[i-1]) >= 0
+	case c == '<':
+		s.heredoc = s.heredoc || afterLess
+		s.less = true
+	}
+}
+
+// where describes why a placeholder cannot go where the scanner is, or returns "" if it can.
+func (s *templateScanner) where() string {
+	switch {
+	case s.heredoc:
+		return "after a heredoc"
+	case s.escaped:
+		return "after a backslash"
+	case s.comment:
+		return "in a comment"
+	case s.quote == '\'':
+		return "inside single quotes"
+	case s.quote == '"':
+		return "inside double quotes"
+	case s.quote == '`':
+		return "inside backticks"
+	}
+	return ""
+}
+
+// ToShellScript returns an sh script that runs the pipeline.  It can be saved and run without Go to reproduce what the
+// pipeline does: environment variables shared by every stage are exported, a directory shared by every stage is
+// changed into, and stages that differ from the rest run in a subshell with their own directory or environment.
+// Stages with an explicit environment that replaces the inherited one are run with "env -i".
+func (p *PipedCmd) ToShellScript() string {
+	stages := p.stages()
+	dirs := make([]string, len(stages))
+	deltas := make([][]string, len(stages))
+	for i, s := range stages {
+		dirs[i] = s.dir
+		if dirs[i] == "" {
+			dirs[i] = p.dir
+		}
+		if s.env == nil {
+			deltas[i] = envDelta(s.environ())
+		}
+	}
+	var b strings.Builder
+	b.WriteString("#!/bin/sh\nset -e\n")
+	sharedEnv := allEqual(len(stages), func(i int) string { return strings.Join(deltas[i], "\x00") })
+	if sharedEnv {
+		for _, e := range deltas[0] {
+			b.WriteString("export " + quoteAssignment(e) + "\n")
+		}
+	}
+	sharedDir := allEqual(len(stages), func(i int) string { return dirs[i] })
+	if sharedDir && dirs[0] != "" {
+		b.WriteString("cd " + shellQuote(dirs[0]) + "\n")
+	}
+	parts := make([]string, 0, len(stages))
+	for i, s := range stages {
+		var line string
+		switch {
+		case s.env != nil:
+			line = "env -i " + quoteCommand(s.environ(), s.cmd, s.args)
+		case sharedEnv:
+			line = quoteCommand(nil, s.cmd, s.args)
+		default:
+			line = quoteCommand(deltas[i], s.cmd, s.args)
+		}
+		if !sharedDir && dirs[i] != "" {
+			line = "(cd " + shellQuote(dirs[i]) + " && exec " + line + ")"
+		}
+		parts = append(parts, line)
+	}
+	b.WriteString(joinStages(stages, parts) + "\n")
+	return b.String()
+}
+
+// joinStages joins the rendered stages with pipes, redirecting stages that pipe their stderr.
+func joinStages(stages []*PipedCmd, parts []string) string {
+	var b strings.Builder
+	for i, part := range parts {
+		b.WriteString(part)
+		if i == len(parts)-1 {
+			break
+		}
+		if stages[i].pipeStderr {
+			b.WriteString(" 2>&1 >/dev/null")
+		}
+		b.WriteString(" | ")
+	}
+	return b.String()
+}
+
+// stages returns the stages of the pipeline, head first, ending with p.
+func (p *PipedCmd) stages() []*PipedCmd {
+	var ret []*PipedCmd
+	for current := p; current != nil; current = current.readFrom {
+		ret = append([]*PipedCmd{current}, ret...)
+	}
+	return ret
+}
+
+// envDelta returns the assignments of env that this process does not already have.
+func envDelta(env []string) []string {
+	var ret []string
+	for _, e := range env {
+		k, v, _ := strings.Cut(e, "=")
+		if current, exists := os.LookupEnv(k); !exists || current != v {
+			ret = append(ret, e)
+		}
+	}
+	return ret
+}
+
+func allEqual(n int, key func(i int) string) bool {
+	for i := 1; i < n; i++ {
+		if key(i) != key(0) {
+			return false
+		}
+	}
+	return true
+}
+
+func quoteCommand(env []string, cmd string, args []string) string {
+	parts := make([]string, 0, len(env)+len(args)+1)
+	for _, e := range env {
+		parts = append(parts, quoteAssignment(e))
+	}
+	parts = append(parts, shellQuote(cmd))
+	for _, a := range args {
+		parts = append(parts, shellQuote(a))
+	}
+	return strings.Join(parts, " ")
+}
+
+func quoteAssignment(e string) string {
+	k, v, _ := strings.Cut(e, "=")
+	return k + "=" + shellQuote(v)
+}
+
+// shellQuote quotes s so a POSIX shell reads it back as exactly one word.
+func shellQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	safe := true
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("@%+=:,./_-", r)) {
+			safe = false
+			break
+		}
+	}
+	if safe {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
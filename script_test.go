@@ -0,0 +1,108 @@
+package pipe_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cresta/pipe"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuoted(t *testing.T) {
+	p := pipe.Shell("FOO='a b' echo hi 'there world'").Pipe("grep", "it's")
+	require.Equal(t, `FOO='a b' echo hi 'there world' | grep 'it'\''s'`, p.Quoted())
+}
+
+func TestToShellScript(t *testing.T) {
+	dir := t.TempDir()
+	other := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "in.txt"), []byte("hello\n"), 0600))
+	p := pipe.Shell("cat in.txt").WithDir(dir).Pipe("sh", "-c", "tr a-z A-Z; pwd").WithDir(other)
+	require.Equal(t, "#!/bin/sh\nset -e\n(cd "+dir+" && exec env -i cat in.txt) | (cd "+other+" && exec sh -c 'tr a-z A-Z; pwd')\n", p.ToShellScript())
+
+	var want, got bytes.Buffer
+	require.NoError(t, p.Execute(context.Background(), nil, &want, nil))
+	require.NoError(t, pipe.NewPiped("sh", "-c", p.ToShellScript()).Execute(context.Background(), nil, &got, nil))
+	require.Equal(t, "HELLO\n"+other+"\n", want.String())
+	require.Equal(t, want.String(), got.String())
+}
+
+func TestToShellScriptSharedEnvAndDir(t *testing.T) {
+	dir := t.TempDir()
+	require.Equal(t, "#!/bin/sh\nset -e\ncd "+dir+"\necho ''\n", pipe.NewPiped("echo", "").WithDir(dir).ToShellScript())
+
+	p := pipe.NewPiped("sh", "-c", "echo $A").PrependPath("/opt/bin").Pipe("cat").PrependPath("/opt/bin")
+	require.Equal(t, "#!/bin/sh\nset -e\nexport PATH=/opt/bin:"+os.Getenv("PATH")+"\nsh -c 'echo $A' | cat\n", p.ToShellScript())
+
+	p = pipe.Shell("A=1 env")
+	require.Equal(t, "#!/bin/sh\nset -e\nenv -i A=1 env\n", p.ToShellScript())
+}
+
+func TestSafeCommand(t *testing.T) {
+	var buf bytes.Buffer
+	p := pipe.SafeCommand("echo %s | tr a-z A-Z", "hello world")
+	require.NoError(t, p.Execute(context.Background(), nil, &buf, nil))
+	require.Equal(t, "HELLO WORLD\n", buf.String())
+}
+
+func TestSafeCommandMaliciousArg(t *testing.T) {
+	dir := t.TempDir()
+	marker := filepath.Join(dir, "pwned")
+	for _, arg := range []string{
+		"x; touch " + marker,
+		"$(touch " + marker + ")",
+		"`touch " + marker + "`",
+		"'; touch " + marker + "; echo '",
+		"x\ntouch " + marker,
+	} {
+		var buf bytes.Buffer
+		require.NoError(t, pipe.SafeCommand("printf '%%s\\n' %s", arg).Execute(context.Background(), nil, &buf, nil))
+		require.Equal(t, arg+"\n", buf.String())
+		require.NoFileExists(t, marker)
+	}
+}
+
+func TestSafeCommandCommandSubstitution(t *testing.T) {
+	dir := t.TempDir()
+	marker := filepath.Join(dir, "pwned")
+	arg := "x); touch " + marker + "; echo $(echo"
+	var buf bytes.Buffer
+	require.NoError(t, pipe.SafeCommand("echo $(printf '%%s\\n' %s)", arg).Execute(context.Background(), nil, &buf, nil))
+	require.Equal(t, arg+"\n", buf.String())
+	require.NoFileExists(t, marker)
+}
+
+func TestSafeCommandUnsafePlaceholder(t *testing.T) {
+	for _, template := range []string{
+		`echo "%s"`,
+		`echo '%s'`,
+		"echo `echo %s`",
+		`echo "$(echo %s)"`,
+		`echo \%s`,
+		"echo # %s",
+		"echo hi #%s",
+		"cat <<EOF\n%s\nEOF",
+		"cat <<'EOF'\nx\nEOF\necho %s",
+	} {
+		require.Panics(t, func() { pipe.SafeCommand(template, "; touch pwned #") }, template)
+	}
+	for _, template := range []string{
+		`echo '%%s' %s`,
+		`echo "a" %s 'b'`,
+		`echo \" %s`,
+		"echo a#b %s",
+		"echo # comment\necho %s",
+		"sort <in %s",
+		"echo '<<' %s",
+		"echo \\<<%s",
+	} {
+		require.NotPanics(t, func() { pipe.SafeCommand(template, "x") }, template)
+	}
+}
+
+func TestSafeCommandPlaceholderMismatch(t *testing.T) {
+	require.Panics(t, func() { pipe.SafeCommand("echo %s %s", "one") })
+}
@@ -0,0 +1,153 @@
+package pipe
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Sequence runs pipelines one after another, each depending on how the ones before it went, like the shell's && and
+// ||.  Build one with And or Or on the first pipeline.
+//
+//	pipe.Shell("make build").And(pipe.Shell("make test")).Or(pipe.Shell("make clean"))
+type Sequence struct {
+	steps         []sequenceStep
+	shareDeadline bool
+}
+
+type sequenceStep struct {
+	p *PipedCmd
+	// ifFailed runs the step only if the step before failed, rather than only if it succeeded.  It is ignored on the
+	// first step, which always runs.
+	ifFailed bool
+	// delay is how long to wait before running the step
+	delay time.Duration
+}
+
+// And returns a sequence that runs p, then next only if p succeeded, like the shell's "p && next".
+func (p *PipedCmd) And(next *PipedCmd) *Sequence {
+	return p.sequence().And(next)
+}
+
+// Or returns a sequence that runs p, then next only if p failed, like the shell's "p || next".
+func (p *PipedCmd) Or(next *PipedCmd) *Sequence {
+	return p.sequence().Or(next)
+}
+
+// AndAfter is like And, but waits d before running next.
+func (p *PipedCmd) AndAfter(d time.Duration, next *PipedCmd) *Sequence {
+	return p.sequence().AndAfter(d, next)
+}
+
+func (p *PipedCmd) sequence() *Sequence {
+	return &Sequence{steps: []sequenceStep{{p: p}}}
+}
+
+// And adds next to the sequence, to run only if the last step that ran succeeded.
+func (s *Sequence) And(next *PipedCmd) *Sequence {
+	s.steps = append(s.steps, sequenceStep{p: next})
+	return s
+}
+
+// Or adds next to the sequence, to run only if the last step that ran failed.
+func (s *Sequence) Or(next *PipedCmd) *Sequence {
+	s.steps = append(s.steps, sequenceStep{p: next, ifFailed: true})
+	return s
+}
+
+// AndAfter is like And, but waits d before running next, for steps such as a health check that need what came before
+// to settle.  The wait ends early with the context's error if it is cancelled.
+func (s *Sequence) AndAfter(d time.Duration, next *PipedCmd) *Sequence {
+	s.steps = append(s.steps, sequenceStep{p: next, delay: d})
+	return s
+}
+
+// WithDeadlineSharing splits the time left before the context's deadline evenly between the steps still to come, so
+// an early step overrunning cannot starve the steps after it.  Each step is killed once it has used its share, which
+// is the time left when it starts divided by the number of steps from it to the end, including ones that may be
+// skipped.  Time a step leaves unused is shared among the rest.  It has no effect without a deadline.
+func (s *Sequence) WithDeadlineSharing() *Sequence {
+	s.shareDeadline = true
+	return s
+}
+
+// Run runs the steps of the sequence like Execute, each writing to os.Stdout, or to its writer set with To.
+func (s *Sequence) Run(ctx context.Context) error {
+	return s.run(ctx, func(ctx context.Context, p *PipedCmd) error {
+		return p.Execute(ctx, nil, p.defaultStdout(), os.Stderr)
+	})
+}
+
+// Execute runs the steps of the sequence in order, each with the same stdin, stdout and stderr, the way the shell
+// would.  It returns the error of the last step that ran, so "a || b" succeeds if b does.
+func (s *Sequence) Execute(ctx context.Context, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+	return s.run(ctx, func(ctx context.Context, p *PipedCmd) error {
+		return p.Execute(ctx, stdin, stdout, stderr)
+	})
+}
+
+// run calls execute with each step that should run, in order.
+func (s *Sequence) run(ctx context.Context, execute func(ctx context.Context, p *PipedCmd) error) error {
+	var err error
+	for i, step := range s.steps {
+		if i > 0 && (err != nil) != step.ifFailed {
+			continue
+		}
+		if step.delay > 0 {
+			if waitErr := sleep(ctx, step.delay); waitErr != nil {
+				return waitErr
+			}
+		}
+		err = s.execute(ctx, i, step.p, execute)
+	}
+	return err
+}
+
+// execute runs step i with execute, with its share of the deadline if the sequence shares it.
+func (s *Sequence) execute(ctx context.Context, i int, p *PipedCmd, execute func(ctx context.Context, p *PipedCmd) error) error {
+	if deadline, ok := ctx.Deadline(); ok && s.shareDeadline {
+		share := time.Until(deadline) / time.Duration(len(s.steps)-i)
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, share)
+		defer cancel()
+	}
+	return execute(ctx, p)
+}
+
+// Else sets fallback to be run by RunWithFallback if the pipeline ending at p fails, such as a slower but more
+// reliable way of doing the same thing.  Unlike Or, the fallback is part of p, and it may have a fallback of its own.
+// It returns p.
+func (p *PipedCmd) Else(fallback *PipedCmd) *PipedCmd {
+	p.fallback = fallback
+	return p
+}
+
+// RunWithFallback runs the pipeline like Run and, if it fails, runs its fallback from Else in its place, with the same
+// context.  It returns nil if either succeeds.  If the fallback fails too, the error wraps both failures, the
+// fallback's first.  The fallback is not run if ctx is done, since it would fail straight away.  Anything the failed
+// pipeline wrote before failing has already been written, so the fallback's output follows it.
+func (p *PipedCmd) RunWithFallback(ctx context.Context) error {
+	err := p.Run(ctx)
+	if err == nil || p.fallback == nil || ctx.Err() != nil {
+		return err
+	}
+	if fallbackErr := p.fallback.RunWithFallback(ctx); fallbackErr != nil {
+		return fmt.Errorf("fallback %s failed: %w, after %s failed: %w", p.fallback.describe(), fallbackErr,
+			p.describe(), err)
+	}
+	return nil
+}
+
+// sleep waits for d, or until ctx is done, in which case it returns ctx's error.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,119 @@
+package pipe_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cresta/pipe"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSequenceAndOr(t *testing.T) {
+	var out bytes.Buffer
+	err := pipe.NewPiped("echo", "one").
+		And(pipe.NewPiped("false")).
+		And(pipe.NewPiped("echo", "skipped")).
+		Or(pipe.NewPiped("echo", "recovered")).
+		Execute(context.Background(), nil, &out, nil)
+	require.NoError(t, err)
+	require.Equal(t, "one\nrecovered\n", out.String())
+}
+
+func TestSequenceRunTo(t *testing.T) {
+	var first, second bytes.Buffer
+	err := pipe.NewPiped("echo", "one").To(&first).
+		And(pipe.NewPiped("echo", "two").To(&second)).
+		Run(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "one\n", first.String())
+	require.Equal(t, "two\n", second.String())
+}
+
+func TestSequenceReturnsLastError(t *testing.T) {
+	err := pipe.NewPiped("true").And(pipe.NewPiped("false")).Execute(context.Background(), nil, nil, nil)
+	require.Error(t, err)
+}
+
+func TestSequenceAndAfter(t *testing.T) {
+	var out bytes.Buffer
+	start := time.Now()
+	err := pipe.NewPiped("echo", "restart").
+		AndAfter(200*time.Millisecond, pipe.NewPiped("echo", "check")).
+		Execute(context.Background(), nil, &out, nil)
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond)
+	require.Equal(t, "restart\ncheck\n", out.String())
+}
+
+func TestSequenceAndAfterCancelled(t *testing.T) {
+	var out bytes.Buffer
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := pipe.NewPiped("echo", "restart").
+		AndAfter(time.Minute, pipe.NewPiped("echo", "check")).
+		Execute(ctx, nil, &out, nil)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Less(t, time.Since(start), 5*time.Second)
+	require.Equal(t, "restart\n", out.String())
+}
+
+func TestSequenceAndAfterSkippedOnFailure(t *testing.T) {
+	start := time.Now()
+	err := pipe.NewPiped("false").AndAfter(time.Minute, pipe.NewPiped("true")).Execute(context.Background(), nil, nil, nil)
+	require.Error(t, err)
+	require.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestSequenceDeadlineSharing(t *testing.T) {
+	build := func() *pipe.Sequence {
+		return pipe.NewPiped("true").
+			And(pipe.NewPiped("sh", "-c", "sleep 0.5; echo second")).
+			And(pipe.NewPiped("echo", "third"))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 900*time.Millisecond)
+	defer cancel()
+	var out bytes.Buffer
+	require.NoError(t, build().Execute(ctx, nil, &out, nil))
+	require.Equal(t, "second\nthird\n", out.String())
+
+	ctx, cancel = context.WithTimeout(context.Background(), 900*time.Millisecond)
+	defer cancel()
+	out.Reset()
+	err := build().WithDeadlineSharing().Execute(ctx, nil, &out, nil)
+	var pipeErr *pipe.PipelineError
+	require.ErrorAs(t, err, &pipeErr)
+	require.Equal(t, "sh", pipeErr.Cmd)
+	require.Equal(t, pipe.StageKilled, pipeErr.Outcome)
+	require.Empty(t, out.String())
+	require.NoError(t, ctx.Err())
+}
+
+func TestRunWithFallback(t *testing.T) {
+	var out bytes.Buffer
+	err := pipe.NewPiped("sh", "-c", "exit 3").
+		Else(pipe.NewPiped("echo", "slow path").To(&out)).
+		RunWithFallback(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "slow path\n", out.String())
+}
+
+func TestRunWithFallbackSkippedOnSuccess(t *testing.T) {
+	var out, fallback bytes.Buffer
+	err := pipe.NewPiped("echo", "fast path").To(&out).
+		Else(pipe.NewPiped("echo", "slow path").To(&fallback)).
+		RunWithFallback(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "fast path\n", out.String())
+	require.Empty(t, fallback.String())
+}
+
+func TestRunWithFallbackBothFail(t *testing.T) {
+	err := pipe.NewPiped("sh", "-c", "exit 3").Else(pipe.NewPiped("sh", "-c", "exit 4")).
+		RunWithFallback(context.Background())
+	require.Error(t, err)
+	require.Equal(t, 4, pipe.ExitCodeOf(err))
+	require.Contains(t, err.Error(), "exit status 3")
+}
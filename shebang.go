@@ -0,0 +1,91 @@
+package pipe
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// maxShebang is how much of a file is read looking for its interpreter line
+const maxShebang = 256
+
+// WithShebangResolution runs stages whose command is a script by reading the script's "#!" line and running the
+// interpreter it names ourselves, rather than relying on the operating system to do it.  Windows never honors
+// shebangs, so this is what makes a pipeline of scripts portable there.  Interpreters that do not exist at the path
+// given, such as /bin/bash on Windows, and interpreters run through "/usr/bin/env" are looked up by name in PATH.
+//
+// Commands that are not files starting with "#!" are run directly, as usual.
+func (p *PipedCmd) WithShebangResolution() *PipedCmd {
+	return p.setOption(func(o *options) {
+		o.resolveShebang = true
+	})
+}
+
+// resolveShebang rewrites cmd to run the interpreter of the script it would run, if it is one.
+func resolveShebang(cmd *exec.Cmd, name string) {
+	script := cmd.Path
+	if cmd.Err != nil {
+		// Scripts are often not executable, or lack an extension Windows would find, so a failed lookup may still be a
+		// script we can run
+		script = name
+	}
+	// A relative script is relative to the directory the stage runs in, not ours
+	file := script
+	if !filepath.IsAbs(file) && cmd.Dir != "" {
+		file = filepath.Join(cmd.Dir, file)
+	}
+	interpreter := readShebang(file)
+	if len(interpreter) == 0 {
+		return
+	}
+	if path.Base(filepath.ToSlash(interpreter[0])) == "env" && len(interpreter) > 1 {
+		// env is given the rest of the line as one argument, which only -S splits
+		if split, ok := strings.CutPrefix(interpreter[1], "-S"); ok {
+			if fields := strings.Fields(split); len(fields) > 0 {
+				interpreter = fields
+			}
+		} else {
+			interpreter = interpreter[1:]
+		}
+	}
+	program, err := exec.LookPath(interpreter[0])
+	if err != nil {
+		program, err = exec.LookPath(path.Base(filepath.ToSlash(interpreter[0])))
+	}
+	cmd.Path = program
+	cmd.Err = err
+	cmd.Args = append(append(append([]string{interpreter[0]}, interpreter[1:]...), script), cmd.Args[1:]...)
+}
+
+// readShebang returns the interpreter on the "#!" line of file, followed by the rest of the line, if there is any, as a
+// single argument, the way Linux runs it.  It returns nil if file does not have one.
+func readShebang(file string) []string {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	line, err := bufio.NewReaderSize(f, maxShebang).ReadSlice('\n')
+	if err != nil && len(line) == 0 {
+		return nil
+	}
+	if !bytes.HasPrefix(line, []byte("#!")) {
+		return nil
+	}
+	rest := strings.TrimSpace(string(line[2:]))
+	if rest == "" {
+		return nil
+	}
+	interpreter, arg, found := strings.Cut(rest, " ")
+	if !found {
+		interpreter, arg, _ = strings.Cut(rest, "\t")
+	}
+	if arg = strings.TrimSpace(arg); arg == "" {
+		return []string{interpreter}
+	}
+	return []string{interpreter, arg}
+}
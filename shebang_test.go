@@ -0,0 +1,57 @@
+package pipe_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/cresta/pipe"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShebangResolution(t *testing.T) {
+	if _, err := exec.LookPath("python3"); err != nil {
+		t.Skip("python3 is not installed")
+	}
+	dir := t.TempDir()
+	script := filepath.Join(dir, "hello.py")
+	// Not executable, so only works if we run the interpreter ourselves
+	require.NoError(t, os.WriteFile(script, []byte("#!/usr/bin/env python3\nimport sys\nprint('hello', sys.argv[1])\n"), 0600))
+	var buf bytes.Buffer
+	require.NoError(t, pipe.NewPiped(script, "world").WithShebangResolution().Execute(context.Background(), nil, &buf, nil))
+	require.Equal(t, "hello world\n", buf.String())
+
+	require.Error(t, pipe.NewPiped(script, "world").Execute(context.Background(), nil, nil, nil))
+}
+
+func TestShebangResolutionWithoutShebang(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, pipe.NewPiped("echo", "hi").WithShebangResolution().Execute(context.Background(), nil, &buf, nil))
+	require.Equal(t, "hi\n", buf.String())
+}
+
+func TestShebangResolutionSingleArgument(t *testing.T) {
+	if _, err := os.Stat("/bin/echo"); err != nil {
+		t.Skip("/bin/echo does not exist")
+	}
+	dir := t.TempDir()
+	script := filepath.Join(dir, "script")
+	require.NoError(t, os.WriteFile(script, []byte("#!/bin/echo a  b\n"), 0600))
+	var buf bytes.Buffer
+	require.NoError(t, pipe.NewPiped(script, "world").WithShebangResolution().Execute(context.Background(), nil, &buf, nil))
+	require.Equal(t, "a  b "+script+" world\n", buf.String())
+}
+
+func TestShebangResolutionRelativeToDir(t *testing.T) {
+	if _, err := os.Stat("/bin/echo"); err != nil {
+		t.Skip("/bin/echo does not exist")
+	}
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "greet"), []byte("#!/bin/echo hi\n"), 0600))
+	var buf bytes.Buffer
+	require.NoError(t, pipe.NewPiped("./greet").WithDir(dir).WithShebangResolution().Execute(context.Background(), nil, &buf, nil))
+	require.Equal(t, "hi ./greet\n", buf.String())
+}
@@ -0,0 +1,46 @@
+package pipe
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"sync"
+)
+
+// WithUnblockSignals makes sure the stage starts with the default handling of sigs, even if this process ignores them.
+//
+// A program started while its parent ignores a signal starts out ignoring it too, and many never undo that: a shell
+// cannot trap a signal that was ignored when it started.  Go programs pass on signals ignored with signal.Ignore, or
+// ignored by whatever started them, as nohup does with SIGHUP, so commands they run can hang on or shrug off signals
+// meant to stop them.  Go already resets the signal mask of the commands it runs to the one this process started
+// with, so only ignored signals leak through.
+//
+// This only matters on Unix.  For the moment the stage starts, sigs are handled by this process rather than ignored,
+// so the stage gets the default handling, and they are ignored again once it has started.  Any of sigs that arrive in
+// that moment are dropped, just as they would have been.
+func (p *PipedCmd) WithUnblockSignals(sigs ...os.Signal) *PipedCmd {
+	p.unblockSignals = append(p.unblockSignals, sigs...)
+	return p
+}
+
+// signalMu stops two stages starting at once from both changing how ignored signals are handled.
+var signalMu sync.Mutex
+
+// startUnblocked starts cmd with the default handling of any of sigs this process ignores.
+func startUnblocked(cmd *exec.Cmd, sigs []os.Signal) error {
+	var ignored []os.Signal
+	for _, sig := range sigs {
+		if signal.Ignored(sig) {
+			ignored = append(ignored, sig)
+		}
+	}
+	if len(ignored) == 0 {
+		return cmd.Start()
+	}
+	signalMu.Lock()
+	defer signalMu.Unlock()
+	// Commands start with signals this process handles, rather than ignores, reset to their default handling
+	signal.Notify(make(chan os.Signal, 1), ignored...)
+	defer signal.Ignore(ignored...)
+	return cmd.Start()
+}
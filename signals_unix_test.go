@@ -0,0 +1,33 @@
+//go:build unix
+
+package pipe_test
+
+import (
+	"bytes"
+	"context"
+	"os/signal"
+	"syscall"
+	"testing"
+
+	"github.com/cresta/pipe"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnblockSignals(t *testing.T) {
+	signal.Ignore(syscall.SIGUSR1)
+	t.Cleanup(func() {
+		signal.Reset(syscall.SIGUSR1)
+	})
+	script := "kill -USR1 $$; echo survived"
+
+	var buf bytes.Buffer
+	require.NoError(t, pipe.NewPiped("sh", "-c", script).Execute(context.Background(), nil, &buf, nil))
+	require.Equal(t, "survived\n", buf.String())
+
+	buf.Reset()
+	err := pipe.NewPiped("sh", "-c", script).WithUnblockSignals(syscall.SIGUSR1).Execute(context.Background(), nil, &buf, nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "user defined signal 1")
+	require.Empty(t, buf.String())
+	require.True(t, signal.Ignored(syscall.SIGUSR1))
+}
@@ -0,0 +1,70 @@
+package pipe
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+)
+
+// RunSplit runs the pipeline and calls f with each token of the final stdout, as split by split.  The token slice is
+// only valid until f returns.  If f returns an error the pipeline is cancelled and that error is returned.
+//
+// A common use is splitting on null bytes so file names with spaces survive
+//
+//	Shell("find . -print0").RunSplit(ctx, ScanNull, f)
+func (p *PipedCmd) RunSplit(ctx context.Context, split bufio.SplitFunc, f func(token []byte) error) error {
+	cmdCtx, withCancel := context.WithCancel(ctx)
+	defer withCancel()
+	r, w := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		err := p.Execute(cmdCtx, nil, w, os.Stderr)
+		_ = w.Close()
+		done <- err
+	}()
+	scanner := bufio.NewScanner(r)
+	scanner.Split(split)
+	if maxSize := p.options().maxTokenSize; maxSize > 0 {
+		scanner.Buffer(nil, maxSize)
+	}
+	var scanErr error
+	for scanner.Scan() {
+		if err := f(scanner.Bytes()); err != nil {
+			scanErr = err
+			break
+		}
+	}
+	if scanErr == nil {
+		scanErr = scanner.Err()
+	}
+	if scanErr != nil {
+		// Stop the pipeline and unblock anything still writing to us
+		withCancel()
+		_ = r.CloseWithError(scanErr)
+		<-done
+		return scanErr
+	}
+	return <-done
+}
+
+// RunLines runs the pipeline and calls f with each line of the final stdout, without the line ending.
+func (p *PipedCmd) RunLines(ctx context.Context, f func(line string) error) error {
+	return p.RunSplit(ctx, bufio.ScanLines, func(token []byte) error {
+		return f(string(token))
+	})
+}
+
+// ScanNull is a bufio.SplitFunc that splits on null bytes, the separator used by tools like "find -print0" and
+// "xargs -0".
+func ScanNull(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	for i, b := range data {
+		if b == 0 {
+			return i + 1, data[:i], nil
+		}
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
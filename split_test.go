@@ -0,0 +1,53 @@
+package pipe_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/cresta/pipe"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunSplitNull(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a file", "b"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0600))
+	}
+	var names []string
+	err := pipe.NewPiped("find", dir, "-type", "f", "-print0").RunSplit(context.Background(), pipe.ScanNull, func(token []byte) error {
+		names = append(names, filepath.Base(string(token)))
+		return nil
+	})
+	require.NoError(t, err)
+	sort.Strings(names)
+	require.Equal(t, []string{"a file", "b"}, names)
+}
+
+func TestRunLines(t *testing.T) {
+	var lines []string
+	require.NoError(t, pipe.Shell("printf 'a\\nb\\n'").RunLines(context.Background(), func(line string) error {
+		lines = append(lines, line)
+		return nil
+	}))
+	require.Equal(t, []string{"a", "b"}, lines)
+}
+
+func TestRunSplitCallbackError(t *testing.T) {
+	stop := errors.New("stop")
+	err := pipe.Shell("yes").RunLines(context.Background(), func(line string) error {
+		return stop
+	})
+	require.ErrorIs(t, err, stop)
+}
+
+func TestRunSplitMaxTokenSize(t *testing.T) {
+	err := pipe.Shell("echo 0123456789").WithMaxTokenSize(4).RunSplit(context.Background(), bufio.ScanLines, func(token []byte) error {
+		return nil
+	})
+	require.ErrorIs(t, err, bufio.ErrTooLong)
+}
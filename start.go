@@ -0,0 +1,172 @@
+package pipe
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// WithStdinPipe has Start connect the head of the pipeline's stdin to the Running it returns, so the caller can feed
+// the pipeline with Write and end its input with CloseInput.  Without it the pipeline reads nothing from stdin.
+func (p *PipedCmd) WithStdinPipe() *PipedCmd {
+	return p.setOption(func(o *options) {
+		o.stdinPipe = true
+	})
+}
+
+// Start runs the pipeline in the background and returns straight away.  Its stdout and stderr are captured, and once
+// it has finished its Result can be read as many times as needed, from as many goroutines as needed.
+//
+// Everything the pipeline writes is kept in memory for as long as the Running is, so pipelines with a lot of output
+// are better streamed with RunReader or RunLines.
+func (p *PipedCmd) Start(ctx context.Context) (*Running, error) {
+	r := &Running{
+		done: make(chan struct{}),
+	}
+	opts := p.options()
+	if opts.stdinPipe && opts.openStdin != nil {
+		return nil, ErrStdinConflict
+	}
+	var stdin *os.File
+	if opts.stdinPipe {
+		var err error
+		stdin, r.input, err = os.Pipe()
+		if err != nil {
+			return nil, fmt.Errorf("unable to make stdin pipe: %w", err)
+		}
+	}
+	e, err := p.start(ctx, fileReader(stdin), &r.stdout, &r.stderr)
+	if err != nil {
+		if stdin != nil {
+			_ = stdin.Close()
+			_ = r.input.Close()
+		}
+		return nil, err
+	}
+	r.e = e
+	if stdin != nil && !opts.managesStdin() {
+		// The head of the pipeline has its own copy now.  With WithMaxInputBytes or WithStdinTransform it instead reads
+		// through this process, so ours is kept until the pipeline is done.
+		_ = stdin.Close()
+		stdin = nil
+	}
+	go r.wait(stdin)
+	return r, nil
+}
+
+// Running is a pipeline started by Start.
+type Running struct {
+	e *execution
+	// input is the write end of the head's stdin, with WithStdinPipe.  It is closed once, by CloseInput or once the
+	// pipeline is done.
+	input      *os.File
+	closeInput sync.Once
+	inputErr   error
+	stdout     syncBuffer
+	stderr     syncBuffer
+	done       chan struct{}
+	result     Result
+}
+
+// Result is how a pipeline run by Start ended.
+type Result struct {
+	Stdout []byte
+	Stderr []byte
+	// ExitCodes has the exit code of each stage, head first.  It is -1 for stages that did not exit normally or never
+	// started.
+	ExitCodes []int
+	// Err is the error Execute would have returned
+	Err error
+}
+
+// wait waits for the pipeline and stores its Result, then closes stdin if it is not nil, along with our end of it.
+func (r *Running) wait(stdin *os.File) {
+	err := r.e.wait()
+	if stdin != nil {
+		_ = stdin.Close()
+	}
+	if r.input != nil {
+		_ = r.CloseInput()
+	}
+	r.result = Result{
+		Stdout:    r.stdout.Bytes(),
+		Stderr:    r.stderr.Bytes(),
+		ExitCodes: make([]int, 0, len(r.e.runs)),
+		Err:       err,
+	}
+	for _, s := range r.e.runs {
+		r.result.ExitCodes = append(r.result.ExitCodes, s.exitCode())
+	}
+	close(r.done)
+}
+
+// ErrNoStdinPipe is returned by Write and CloseInput on a pipeline that was not started WithStdinPipe.
+var ErrNoStdinPipe = errors.New("pipeline was not started WithStdinPipe")
+
+// ErrStdinConflict is returned by Start for a pipeline given its stdin both WithStdinPipe and WithStdinFromFS.
+var ErrStdinConflict = errors.New("WithStdinPipe cannot be combined with WithStdinFromFS")
+
+// Write sends p to the stdin of the head of the pipeline.  It fails once the head has stopped reading its input.
+func (r *Running) Write(p []byte) (int, error) {
+	if r.input == nil {
+		return 0, ErrNoStdinPipe
+	}
+	return r.input.Write(p)
+}
+
+// CloseInput closes the stdin of the head of the pipeline, so it sees the end of its input, while the pipeline's
+// output is still captured until it exits.  Tools that read their input to the end, like bc or sqlite3, do not finish
+// until CloseInput is called, and neither do Wait and Result.  It is closed anyway once the pipeline is done, and
+// calling CloseInput again does nothing.
+func (r *Running) CloseInput() error {
+	if r.input == nil {
+		return ErrNoStdinPipe
+	}
+	r.closeInput.Do(func() {
+		r.inputErr = r.input.Close()
+	})
+	return r.inputErr
+}
+
+// Wait blocks until the pipeline has finished and returns its error.
+func (r *Running) Wait() error {
+	<-r.done
+	return r.result.Err
+}
+
+// Result blocks until the pipeline has finished and returns how it ended.  Every call returns the same Result, which
+// callers must not modify.
+func (r *Running) Result() Result {
+	<-r.done
+	return r.result
+}
+
+// fileReader returns f as an io.Reader, or nil if f is nil, so exec.Cmd does not see a typed nil.
+func fileReader(f *os.File) io.Reader {
+	if f == nil {
+		return nil
+	}
+	return f
+}
+
+// syncBuffer is a bytes.Buffer that several stages can write to at once.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Bytes()
+}
@@ -0,0 +1,108 @@
+package pipe_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"testing"
+
+	"github.com/cresta/pipe"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStartResult(t *testing.T) {
+	r, err := pipe.NewPiped("sh", "-c", "echo hi; echo oops >&2").
+		Pipe("tr", "a-z", "A-Z").
+		Start(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, r.Wait())
+	first := r.Result()
+	require.Equal(t, "HI\n", string(first.Stdout))
+	require.Equal(t, "oops\n", string(first.Stderr))
+	require.Equal(t, []int{0, 0}, first.ExitCodes)
+	require.NoError(t, first.Err)
+	require.Equal(t, first, r.Result())
+}
+
+func TestStartResultFailed(t *testing.T) {
+	r, err := pipe.NewPiped("sh", "-c", "echo partial; exit 4").Start(context.Background())
+	require.NoError(t, err)
+	var wg sync.WaitGroup
+	results := make([]pipe.Result, 3)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = r.Result()
+		}(i)
+	}
+	wg.Wait()
+	for _, res := range results {
+		require.Error(t, res.Err)
+		require.Equal(t, []int{4}, res.ExitCodes)
+		require.Equal(t, "partial\n", string(res.Stdout))
+	}
+	require.Equal(t, results[0].Err, r.Wait())
+}
+
+func TestStartFailure(t *testing.T) {
+	_, err := pipe.NewPiped("/does/not/exist").Start(context.Background())
+	require.Error(t, err)
+}
+
+func TestStartDriveBc(t *testing.T) {
+	if _, err := exec.LookPath("bc"); err != nil {
+		t.Skip("bc is not installed")
+	}
+	r, err := pipe.NewPiped("bc").WithStdinPipe().Start(context.Background())
+	require.NoError(t, err)
+	for _, expr := range []string{"1+2", "6*7", "2^10"} {
+		_, err := io.WriteString(r, expr+"\n")
+		require.NoError(t, err)
+	}
+	require.NoError(t, r.CloseInput())
+	require.NoError(t, r.Wait())
+	require.Equal(t, "3\n42\n1024\n", string(r.Result().Stdout))
+}
+
+func TestStartWriteThenCloseInput(t *testing.T) {
+	r, err := pipe.NewPiped("sh", "-c", "while read a b; do echo $((a + b)); done; echo end").
+		Pipe("cat").
+		WithStdinPipe().
+		Start(context.Background())
+	require.NoError(t, err)
+	_, err = r.Write([]byte("1 2\n3 4\n"))
+	require.NoError(t, err)
+	require.NoError(t, r.CloseInput())
+	require.NoError(t, r.Wait())
+	require.Equal(t, "3\n7\nend\n", string(r.Result().Stdout))
+}
+
+func TestStartWithoutStdinPipe(t *testing.T) {
+	r, err := pipe.NewPiped("cat").Start(context.Background())
+	require.NoError(t, err)
+	_, err = r.Write([]byte("hi"))
+	require.ErrorIs(t, err, pipe.ErrNoStdinPipe)
+	require.ErrorIs(t, r.CloseInput(), pipe.ErrNoStdinPipe)
+	require.NoError(t, r.Wait())
+	require.Empty(t, r.Result().Stdout)
+}
+
+func TestStartClosesInputWhenDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r, err := pipe.NewPiped("cat").WithStdinPipe().Start(ctx)
+	require.NoError(t, err)
+	cancel()
+	require.Error(t, r.Wait())
+	_, err = r.Write([]byte("hi"))
+	require.ErrorIs(t, err, os.ErrClosed)
+	require.NoError(t, r.CloseInput())
+}
+
+func TestStartStdinPipeConflictsWithFS(t *testing.T) {
+	_, err := pipe.NewPiped("cat").WithStdinPipe().WithStdinFromFS(testdata, "testdata/fruit.txt").
+		Start(context.Background())
+	require.ErrorIs(t, err, pipe.ErrStdinConflict)
+}
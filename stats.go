@@ -0,0 +1,92 @@
+package pipe
+
+import "time"
+
+// StageOutcome is how a stage of a pipeline ended.
+type StageOutcome int
+
+const (
+	// StageNotStarted stages never ran, because the pipeline ended before they could start
+	StageNotStarted StageOutcome = iota
+	// StageSuccess stages exited with status zero
+	StageSuccess
+	// StageFailed stages exited with a non-zero status, or could not be started
+	StageFailed
+	// StageTimedOut stages were killed by their own WithTimeout
+	StageTimedOut
+	// StageKilled stages were killed by a signal they were not expecting, usually because the pipeline was cancelled or
+	// another stage failed
+	StageKilled
+)
+
+func (o StageOutcome) String() string {
+	switch o {
+	case StageNotStarted:
+		return "not started"
+	case StageSuccess:
+		return "success"
+	case StageFailed:
+		return "failed"
+	case StageTimedOut:
+		return "timed out"
+	case StageKilled:
+		return "killed"
+	}
+	return "unknown"
+}
+
+// PipelineStats describes how a pipeline ran.  Pass one to WithStats to have it filled in.
+type PipelineStats struct {
+	Start    time.Time
+	Duration time.Duration
+	// Stages has an entry for each stage, head first
+	Stages []StageStats
+}
+
+// StageStats describes how one stage of a pipeline ran.
+type StageStats struct {
+	Cmd string
+	// Path and Args are what was actually run, after looking the command up in PATH and any other resolution such as
+	// WithShebangResolution.  Args includes the program name as Args[0].
+	Path    string
+	Args    []string
+	Outcome StageOutcome
+	// ExitCode is -1 if the stage did not exit normally
+	ExitCode int
+	Err      error
+	// Start and End are zero if the stage never started
+	Start time.Time
+	End   time.Time
+}
+
+// WithStats fills in s when the pipeline finishes, however it finishes.
+func (p *PipedCmd) WithStats(s *PipelineStats) *PipedCmd {
+	return p.setOption(func(o *options) {
+		o.stats = s
+	})
+}
+
+func (e *execution) recordStats() {
+	s := e.opts.stats
+	if s == nil {
+		return
+	}
+	s.Start = e.started
+	s.Duration = time.Since(e.started)
+	s.Stages = make([]StageStats, 0, len(e.runs))
+	for _, r := range e.runs {
+		stage := StageStats{
+			Cmd:      r.name,
+			Path:     r.cmd.Path,
+			Args:     append([]string(nil), r.cmd.Args...),
+			Outcome:  r.outcome,
+			ExitCode: r.exitCode(),
+			Err:      r.err,
+			Start:    r.started,
+		}
+		if !r.started.IsZero() {
+			stage.End = r.ended
+		}
+		s.Stages = append(s.Stages, stage)
+	}
+}
@@ -0,0 +1,88 @@
+package pipe_test
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cresta/pipe"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatsSuccessAndFailed(t *testing.T) {
+	var stats pipe.PipelineStats
+	err := pipe.NewPiped("sh", "-c", "echo hi; exit 3").
+		Pipe("cat").
+		WithStats(&stats).
+		Execute(context.Background(), nil, nil, nil)
+	require.Error(t, err)
+	require.Len(t, stats.Stages, 2)
+	require.Equal(t, "sh", stats.Stages[0].Cmd)
+	require.Equal(t, pipe.StageFailed, stats.Stages[0].Outcome)
+	require.Equal(t, 3, stats.Stages[0].ExitCode)
+	require.Error(t, stats.Stages[0].Err)
+	require.Equal(t, pipe.StageSuccess, stats.Stages[1].Outcome)
+	require.Equal(t, 0, stats.Stages[1].ExitCode)
+	require.NoError(t, stats.Stages[1].Err)
+	require.False(t, stats.Stages[1].Start.After(stats.Stages[1].End))
+	require.Positive(t, stats.Duration)
+}
+
+func TestStatsTimedOut(t *testing.T) {
+	var stats pipe.PipelineStats
+	start := time.Now()
+	err := pipe.NewPiped("sleep", "10").WithTimeout(100*time.Millisecond).
+		Pipe("echo", "done").
+		WithStats(&stats).
+		Execute(context.Background(), nil, nil, nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "stage 0 sleep: timed out after 100ms")
+	require.Less(t, time.Since(start), 5*time.Second)
+	require.Equal(t, pipe.StageTimedOut, stats.Stages[0].Outcome)
+	require.Equal(t, -1, stats.Stages[0].ExitCode)
+	require.Equal(t, pipe.StageSuccess, stats.Stages[1].Outcome)
+}
+
+func TestStatsKilled(t *testing.T) {
+	var stats pipe.PipelineStats
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err := pipe.NewPiped("sleep", "10").WithTimeout(time.Minute).
+		WithStats(&stats).
+		Execute(ctx, nil, nil, nil)
+	require.Error(t, err)
+	require.Equal(t, pipe.StageKilled, stats.Stages[0].Outcome)
+	require.Equal(t, "killed", stats.Stages[0].Outcome.String())
+}
+
+func TestStatsNotStarted(t *testing.T) {
+	var stats pipe.PipelineStats
+	err := pipe.Shell("echo hi").Pipe("/does/not/exist").Pipe("cat").
+		WithStats(&stats).
+		Execute(context.Background(), nil, nil, nil)
+	require.Error(t, err)
+	require.Len(t, stats.Stages, 3)
+	require.Equal(t, pipe.StageFailed, stats.Stages[1].Outcome)
+	require.Equal(t, pipe.StageNotStarted, stats.Stages[2].Outcome)
+	require.True(t, stats.Stages[2].Start.IsZero())
+	require.True(t, stats.Stages[2].End.IsZero())
+}
+
+func TestStatsResolvedCommand(t *testing.T) {
+	dir := t.TempDir()
+	writeScript(t, dir, "tool", "echo \"$@\"")
+	var stats pipe.PipelineStats
+	err := pipe.NewPiped("tool", "a b").PrependPath(dir).WithShebangResolution().
+		Pipe("cat").
+		WithStats(&stats).
+		Execute(context.Background(), nil, nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, "/bin/sh", stats.Stages[0].Path)
+	require.Equal(t, []string{"/bin/sh", filepath.Join(dir, "tool"), "a b"}, stats.Stages[0].Args)
+	cat, err := exec.LookPath("cat")
+	require.NoError(t, err)
+	require.Equal(t, cat, stats.Stages[1].Path)
+	require.Equal(t, []string{"cat"}, stats.Stages[1].Args)
+}
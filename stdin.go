@@ -0,0 +1,45 @@
+package pipe
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+)
+
+// WithStdinFromFS feeds the file at path in fsys, such as an embed.FS, to the head of the pipeline's stdin in place of
+// whatever Execute is given.  The file is opened when the pipeline runs, which fails if it does not exist, and closed
+// once the pipeline is done.
+func (p *PipedCmd) WithStdinFromFS(fsys fs.FS, path string) *PipedCmd {
+	return p.setOption(func(o *options) {
+		o.openStdin = func() (io.ReadCloser, error) {
+			f, err := fsys.Open(path)
+			if err != nil {
+				return nil, fmt.Errorf("unable to open stdin: %w", err)
+			}
+			return f, nil
+		}
+	})
+}
+
+// WithMaxInputBytes feeds at most n bytes of stdin to the head of the pipeline, which then sees the end of its input,
+// to process only the start of a stream or to guard against a reader that never ends.
+func (p *PipedCmd) WithMaxInputBytes(n int64) *PipedCmd {
+	return p.setOption(func(o *options) {
+		o.maxInputBytes = n
+	})
+}
+
+// WithStdinTransform feeds the head of the pipeline what f returns in place of its stdin, to change its input on the
+// way in, for example uppercasing, filtering or prepending a header, without another process.  f is given the stdin
+// the pipeline would otherwise read, including one from WithStdinFromFS, or an empty reader if it has none.
+// WithMaxInputBytes limits what f returns.
+func (p *PipedCmd) WithStdinTransform(f func(io.Reader) io.Reader) *PipedCmd {
+	return p.setOption(func(o *options) {
+		o.stdinTransform = f
+	})
+}
+
+// managesStdin reports if the head of the pipeline reads its stdin through this process rather than directly.
+func (o *options) managesStdin() bool {
+	return o.maxInputBytes > 0 || o.stdinTransform != nil
+}
@@ -0,0 +1,113 @@
+package pipe_test
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"io"
+	"io/fs"
+	"strings"
+	"testing"
+
+	"github.com/cresta/pipe"
+	"github.com/stretchr/testify/require"
+)
+
+//go:embed testdata
+var testdata embed.FS
+
+func TestWithStdinFromFS(t *testing.T) {
+	var buf bytes.Buffer
+	err := pipe.NewPiped("sort").WithStdinFromFS(testdata, "testdata/fruit.txt").Execute(context.Background(), nil, &buf, nil)
+	require.NoError(t, err)
+	require.Equal(t, "apple\nbanana\ncherry\n", buf.String())
+}
+
+func TestWithStdinFromFSMissing(t *testing.T) {
+	err := pipe.NewPiped("cat").WithStdinFromFS(testdata, "testdata/missing.txt").Run(context.Background())
+	require.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+// endlessReader is a reader that never runs out.
+type endlessReader struct{}
+
+func (endlessReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 'x'
+	}
+	return len(p), nil
+}
+
+func TestWithMaxInputBytes(t *testing.T) {
+	var buf bytes.Buffer
+	err := pipe.NewPiped("wc", "-c").WithMaxInputBytes(100000).Execute(context.Background(), endlessReader{}, &buf, nil)
+	require.NoError(t, err)
+	require.Equal(t, "100000", strings.TrimSpace(buf.String()))
+}
+
+func TestWithMaxInputBytesFromFS(t *testing.T) {
+	var buf bytes.Buffer
+	err := pipe.NewPiped("cat").WithStdinFromFS(testdata, "testdata/fruit.txt").WithMaxInputBytes(6).
+		Execute(context.Background(), nil, &buf, nil)
+	require.NoError(t, err)
+	require.Equal(t, "banana", buf.String())
+}
+
+func TestWithMaxInputBytesStdinPipe(t *testing.T) {
+	r, err := pipe.NewPiped("cat").WithStdinPipe().WithMaxInputBytes(3).Start(context.Background())
+	require.NoError(t, err)
+	_, err = r.Write([]byte("abcdef"))
+	require.NoError(t, err)
+	require.NoError(t, r.Wait())
+	require.Equal(t, "abc", string(r.Result().Stdout))
+	require.NoError(t, r.CloseInput())
+}
+
+// upperReader uppercases what it reads.
+type upperReader struct {
+	r io.Reader
+}
+
+func (u upperReader) Read(p []byte) (int, error) {
+	n, err := u.r.Read(p)
+	copy(p, bytes.ToUpper(p[:n]))
+	return n, err
+}
+
+func upper(r io.Reader) io.Reader {
+	return upperReader{r: r}
+}
+
+func TestWithStdinTransform(t *testing.T) {
+	var buf bytes.Buffer
+	err := pipe.NewPiped("cat").WithStdinTransform(upper).Execute(context.Background(), strings.NewReader("hello\n"), &buf, nil)
+	require.NoError(t, err)
+	require.Equal(t, "HELLO\n", buf.String())
+}
+
+func TestWithStdinTransformFromFS(t *testing.T) {
+	var buf bytes.Buffer
+	err := pipe.NewPiped("sort").WithStdinFromFS(testdata, "testdata/fruit.txt").WithStdinTransform(upper).
+		WithMaxInputBytes(13).Execute(context.Background(), nil, &buf, nil)
+	require.NoError(t, err)
+	require.Equal(t, "APPLE\nBANANA\n", buf.String())
+}
+
+func TestWithStdinTransformNoStdin(t *testing.T) {
+	var buf bytes.Buffer
+	err := pipe.NewPiped("cat").WithStdinTransform(func(r io.Reader) io.Reader {
+		return io.MultiReader(strings.NewReader("header\n"), r)
+	}).Execute(context.Background(), nil, &buf, nil)
+	require.NoError(t, err)
+	require.Equal(t, "header\n", buf.String())
+}
+
+func TestWithStdinTransformStdinPipe(t *testing.T) {
+	r, err := pipe.NewPiped("cat").WithStdinPipe().WithStdinTransform(upper).Start(context.Background())
+	require.NoError(t, err)
+	_, err = r.Write([]byte("abc"))
+	require.NoError(t, err)
+	require.NoError(t, r.CloseInput())
+	require.NoError(t, r.Wait())
+	require.Equal(t, "ABC", string(r.Result().Stdout))
+}
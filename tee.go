@@ -0,0 +1,68 @@
+package pipe
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+)
+
+// WithTeeFile also writes the pipeline's output to the file at path, like tee, creating or truncating it when the
+// pipeline runs.  It may be used more than once to write several files.  The files are written through a buffer, and
+// once the pipeline is done each is flushed and then closed, in the order they were added, before Execute returns.
+// Any error writing, flushing or closing a file fails the pipeline, so a file is never silently left incomplete.
+func (p *PipedCmd) WithTeeFile(path string) *PipedCmd {
+	return p.setOption(func(o *options) {
+		o.teeFiles = append(o.teeFiles, path)
+	})
+}
+
+// openOutputFile opens the files the pipeline writes its output to.  It is a variable so tests can make closing fail.
+var openOutputFile = func(path string) (io.WriteCloser, error) {
+	return os.Create(path)
+}
+
+// outputFile is an output file the pipeline opened itself, and so must flush and close.
+type outputFile struct {
+	path string
+	buf  *bufio.Writer
+	f    io.WriteCloser
+}
+
+// openOutputs opens the execution's output files and returns stdout writing to them as well.
+func (e *execution) openOutputs(stdout io.Writer) (io.Writer, error) {
+	writers := make([]io.Writer, 0, len(e.opts.teeFiles)+1)
+	if stdout != nil {
+		writers = append(writers, stdout)
+	}
+	for _, path := range e.opts.teeFiles {
+		f, err := openOutputFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open output file: %w", err)
+		}
+		out := outputFile{
+			path: path,
+			buf:  bufio.NewWriter(f),
+			f:    f,
+		}
+		e.outputs = append(e.outputs, out)
+		writers = append(writers, out.buf)
+	}
+	return io.MultiWriter(writers...), nil
+}
+
+// closeOutputs flushes and then closes each output file in the order they were opened, and returns the first error.
+// Every file is closed even if an earlier one fails.
+func (e *execution) closeOutputs() error {
+	var ret error
+	for _, out := range e.outputs {
+		if err := out.buf.Flush(); err != nil && ret == nil {
+			ret = fmt.Errorf("unable to flush output file %s: %w", out.path, err)
+		}
+		if err := out.f.Close(); err != nil && ret == nil {
+			ret = fmt.Errorf("unable to close output file %s: %w", out.path, err)
+		}
+	}
+	e.outputs = nil
+	return ret
+}
@@ -0,0 +1,62 @@
+package pipe_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cresta/pipe"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithTeeFile(t *testing.T) {
+	dir := t.TempDir()
+	first, second := filepath.Join(dir, "first.txt"), filepath.Join(dir, "second.txt")
+	var buf bytes.Buffer
+	err := pipe.NewPiped("seq", "3").WithTeeFile(first).WithTeeFile(second).Execute(context.Background(), nil, &buf, nil)
+	require.NoError(t, err)
+	require.Equal(t, "1\n2\n3\n", buf.String())
+	for _, path := range []string{first, second} {
+		b, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.Equal(t, "1\n2\n3\n", string(b))
+	}
+}
+
+var errCloseFailed = errors.New("close failed")
+
+// recordingFile records what happens to it in events, and fails to close if failClose is set.
+type recordingFile struct {
+	name      string
+	events    *[]string
+	failClose bool
+}
+
+func (f *recordingFile) Write(p []byte) (int, error) {
+	*f.events = append(*f.events, "write "+f.name+" "+string(p))
+	return len(p), nil
+}
+
+func (f *recordingFile) Close() error {
+	*f.events = append(*f.events, "close "+f.name)
+	if f.failClose {
+		return errCloseFailed
+	}
+	return nil
+}
+
+func TestTeeFileCloseOrder(t *testing.T) {
+	var events []string
+	restore := pipe.SetOpenOutputFile(func(path string) (io.WriteCloser, error) {
+		return &recordingFile{name: path, events: &events, failClose: path == "a"}, nil
+	})
+	defer restore()
+	err := pipe.NewPiped("echo", "hi").WithTeeFile("a").WithTeeFile("b").Execute(context.Background(), nil, nil, nil)
+	require.ErrorIs(t, err, errCloseFailed)
+	require.Equal(t, "unable to close output file a: close failed", err.Error())
+	require.Equal(t, []string{"write a hi\n", "close a", "write b hi\n", "close b"}, events)
+}
@@ -0,0 +1,49 @@
+package pipe
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// TempDirPlaceholder is replaced by the path of the temporary directory in the arguments of pipelines run WithTempDir.
+const TempDirPlaceholder = "{tempdir}"
+
+// WithTempDir runs the pipeline in a fresh temporary directory, for scratch files, which is removed with everything in
+// it once the pipeline is done, whether it succeeded, failed or was cancelled.  Stages that have their own directory
+// from WithDir still run there.  TempDirPlaceholder in any stage's arguments is replaced by the directory's path.
+//
+//	NewPiped("sort", "-T", pipe.TempDirPlaceholder, "big.txt").WithTempDir()
+func (p *PipedCmd) WithTempDir() *PipedCmd {
+	return p.setOption(func(o *options) {
+		o.tempDir = true
+	})
+}
+
+// makeTempDir makes the execution's temporary directory, for stop to remove.
+func (e *execution) makeTempDir() error {
+	dir, err := os.MkdirTemp("", "pipe-")
+	if err != nil {
+		return fmt.Errorf("unable to make temp dir: %w", err)
+	}
+	e.tempDir = dir
+	return nil
+}
+
+// removeTempDir removes the execution's temporary directory, if it has one.
+func (e *execution) removeTempDir() {
+	if e.tempDir != "" {
+		_ = os.RemoveAll(e.tempDir)
+	}
+}
+
+// useTempDir runs cmd, for the stage current, in the execution's temporary directory.
+func (e *execution) useTempDir(cmd *exec.Cmd, current *PipedCmd) {
+	if current.dir == "" {
+		cmd.Dir = e.tempDir
+	}
+	for i := 1; i < len(cmd.Args); i++ {
+		cmd.Args[i] = strings.ReplaceAll(cmd.Args[i], TempDirPlaceholder, e.tempDir)
+	}
+}
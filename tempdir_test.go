@@ -0,0 +1,55 @@
+package pipe_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/cresta/pipe"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithTempDir(t *testing.T) {
+	var buf bytes.Buffer
+	err := pipe.NewPiped("sh", "-c", "touch scratch && pwd && echo $0", pipe.TempDirPlaceholder).
+		WithTempDir().Execute(context.Background(), nil, &buf, nil)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+	require.Equal(t, lines[0], lines[1])
+	require.NoDirExists(t, lines[0])
+}
+
+func TestWithTempDirRemovedOnFailure(t *testing.T) {
+	var buf bytes.Buffer
+	err := pipe.NewPiped("sh", "-c", "touch scratch && pwd && exit 1").WithTempDir().
+		Execute(context.Background(), nil, &buf, nil)
+	require.Error(t, err)
+	dir := strings.TrimSpace(buf.String())
+	require.NotEmpty(t, dir)
+	_, err = os.Stat(dir)
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestWithTempDirKeepsOwnDir(t *testing.T) {
+	dir := t.TempDir()
+	var buf bytes.Buffer
+	err := pipe.NewPiped("pwd").WithDir(dir).WithTempDir().Execute(context.Background(), nil, &buf, nil)
+	require.NoError(t, err)
+	require.Equal(t, dir+"\n", buf.String())
+}
+
+func TestWithTempDirRemovedOnPanic(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	require.Panics(t, func() {
+		_ = pipe.NewPiped("true").WithTempDir().WithEnvRewriter(func(env []string) []string {
+			panic("rewriter failed")
+		}).Run(context.Background())
+	})
+	entries, err := os.ReadDir(tmp)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
@@ -0,0 +1,10 @@
+package pipe
+
+import "time"
+
+// WithTimeout kills this stage if it runs for longer than d, without cancelling the rest of the pipeline.  The
+// stage's error says it timed out, and WithStats reports it as StageTimedOut.
+func (p *PipedCmd) WithTimeout(d time.Duration) *PipedCmd {
+	p.timeout = d
+	return p
+}
@@ -0,0 +1,83 @@
+package pipe
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+
+	"github.com/creack/pty"
+	"golang.org/x/term"
+)
+
+// WithForceTTY runs the last stage with its stdout connected to a pseudo terminal, which is then copied to the
+// pipeline's stdout.  Tools that check isatty will behave as if they were run interactively even though the output is
+// captured, for example line buffering their output or keeping colors on.  The terminal is put in raw mode so the
+// output bytes are not rewritten, e.g. "\n" stays "\n" instead of becoming "\r\n".
+//
+// This uses github.com/creack/pty and is only supported where it is, which excludes Windows.
+func (p *PipedCmd) WithForceTTY() *PipedCmd {
+	return p.setOption(func(o *options) {
+		o.forceTTY = true
+	})
+}
+
+// IsTerminal reports whether w is a terminal, which is what tools checking isatty on their stdout would see if given w.
+func IsTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	return ok && term.IsTerminal(int(f.Fd()))
+}
+
+// copiedOutput copies what commands write to one end of a pseudo terminal, or of a pipe with
+// WithAccurateCombinedOutput, into a writer.
+type copiedOutput struct {
+	// write is the end the commands write to, and read the one copied from
+	write *os.File
+	read  *os.File
+	done  chan error
+}
+
+func newTTYOutput() (*copiedOutput, error) {
+	ptmx, tty, err := pty.Open()
+	if err != nil {
+		return nil, fmt.Errorf("unable to allocate pty: %w", err)
+	}
+	if _, err := term.MakeRaw(int(tty.Fd())); err != nil {
+		_ = ptmx.Close()
+		_ = tty.Close()
+		return nil, fmt.Errorf("unable to make pty raw: %w", err)
+	}
+	return &copiedOutput{
+		write: tty,
+		read:  ptmx,
+	}, nil
+}
+
+// copyTo starts copying to w, once the commands holding the other end have started.
+func (c *copiedOutput) copyTo(w io.Writer) {
+	c.done = make(chan error, 1)
+	go func() {
+		if w == nil {
+			w = io.Discard
+		}
+		_, err := io.Copy(w, c.read)
+		// Once every holder of the terminal closes it, reads fail with EIO, which for us is just the end of the output
+		if errors.Is(err, syscall.EIO) {
+			err = nil
+		}
+		c.done <- err
+	}()
+}
+
+// wait waits for the copy to finish and releases both ends.  It is called once the commands have exited, so closing
+// our copy of the end they wrote to lets reads end.
+func (c *copiedOutput) wait() error {
+	_ = c.write.Close()
+	var err error
+	if c.done != nil {
+		err = <-c.done
+	}
+	_ = c.read.Close()
+	return err
+}
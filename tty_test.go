@@ -0,0 +1,31 @@
+package pipe_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/cresta/pipe"
+	"github.com/stretchr/testify/require"
+)
+
+const isattyScript = "if [ -t 1 ]; then echo tty; else echo notty; fi"
+
+func TestForceTTY(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, pipe.NewPiped("sh", "-c", isattyScript).WithForceTTY().Execute(context.Background(), nil, &buf, nil))
+	require.Equal(t, "tty\n", buf.String())
+}
+
+func TestForceTTYLastStage(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, pipe.Shell("echo hi").Pipe("sh", "-c", "cat; "+isattyScript).WithForceTTY().Execute(context.Background(), nil, &buf, nil))
+	require.Equal(t, "hi\ntty\n", buf.String())
+}
+
+func TestWithoutForceTTY(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, pipe.NewPiped("sh", "-c", isattyScript).Execute(context.Background(), nil, &buf, nil))
+	require.Equal(t, "notty\n", buf.String())
+	require.False(t, pipe.IsTerminal(&buf))
+}
@@ -0,0 +1,38 @@
+package pipe
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+)
+
+// ValidationError is returned by RunValidate when the pipeline succeeded but its output did not pass validation.
+type ValidationError struct {
+	// Output is everything the pipeline wrote to stdout
+	Output []byte
+	Err    error
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("output %q failed validation: %v", snippet(e.Output), e.Err)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// RunValidate runs the pipeline and passes its stdout to validate, to catch tools that exit zero with output that is
+// not what it should be, for example by checking it against a JSON schema.  If the pipeline fails its error is
+// returned and validate is not called.  If validate fails its error is returned as a *ValidationError, so the two
+// cases can be told apart with errors.As.
+func (p *PipedCmd) RunValidate(ctx context.Context, validate func([]byte) error) error {
+	var buf bytes.Buffer
+	if err := p.Execute(ctx, nil, &buf, os.Stderr); err != nil {
+		return err
+	}
+	if err := validate(buf.Bytes()); err != nil {
+		return &ValidationError{Output: buf.Bytes(), Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package pipe_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/cresta/pipe"
+	"github.com/stretchr/testify/require"
+)
+
+func validJSON(b []byte) error {
+	if !json.Valid(b) {
+		return errors.New("not valid json")
+	}
+	return nil
+}
+
+func TestRunValidate(t *testing.T) {
+	require.NoError(t, pipe.NewPiped("echo", `{"a": 1}`).RunValidate(context.Background(), validJSON))
+}
+
+func TestRunValidateFailsValidation(t *testing.T) {
+	err := pipe.NewPiped("echo", "oops").RunValidate(context.Background(), validJSON)
+	var validationErr *pipe.ValidationError
+	require.True(t, errors.As(err, &validationErr))
+	require.Equal(t, "oops\n", string(validationErr.Output))
+	require.Contains(t, err.Error(), "not valid json")
+}
+
+func TestRunValidateExecutionFailure(t *testing.T) {
+	called := false
+	err := pipe.NewPiped("sh", "-c", "echo '{}'; exit 2").RunValidate(context.Background(), func(b []byte) error {
+		called = true
+		return nil
+	})
+	require.Error(t, err)
+	require.False(t, called)
+	var validationErr *pipe.ValidationError
+	require.False(t, errors.As(err, &validationErr))
+	var pipeErr *pipe.PipelineError
+	require.True(t, errors.As(err, &pipeErr))
+}